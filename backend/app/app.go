@@ -5,6 +5,9 @@ import (
 	"errors"
 	"modm8/backend/app/appcore"
 	"modm8/backend/app/appservices"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/operations"
+	"modm8/backend/profile"
 
 	gocmd "github.com/go-cmd/cmd"
 	wuntime "github.com/wailsapp/wails/v2/pkg/runtime"
@@ -74,6 +77,24 @@ func (app *Application) Init() (errs []error) {
 		errs = append(errs, err)
 	}
 
+	// Apply again now that the user's settings have replaced the defaults.
+	app.GetSettings().Apply()
+
+	err = profile.MigrateFlatModCache()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = profile.CleanupPartialDownloads()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = profile.CleanupStagingDirs()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	err = app.GetPersistence().Load()
 	if err != nil {
 		errs = append(errs, err)
@@ -95,6 +116,17 @@ func (app *Application) Init() (errs []error) {
 func (app *Application) Startup(wailsCtx context.Context) {
 	app.WailsCtx = wailsCtx
 
+	// Stream download progress to the frontend.
+	downloader.SetProgressHandler(func(event downloader.ProgressEvent, aggregate downloader.AggregateProgress) {
+		wuntime.EventsEmit(wailsCtx, downloader.PROGRESS_EVENT, event)
+		wuntime.EventsEmit(wailsCtx, downloader.AGGREGATE_PROGRESS_EVENT, aggregate)
+	})
+
+	// Let the frontend know what it can cancel.
+	operations.SetHandler(func(event string, op operations.Operation) {
+		wuntime.EventsEmit(wailsCtx, event, op)
+	})
+
 	if app.GetPersistence().WindowState.Maximized {
 		wuntime.WindowMaximise(wailsCtx)
 		return
@@ -111,6 +143,9 @@ func (app *Application) OnBeforeClose(ctx context.Context) bool {
 
 // Called after the frontend has been destroyed, just before the application terminates.
 func (a *Application) Shutdown(ctx context.Context) {
+	// Stop anything still downloading so partial installs get rolled back rather than left behind.
+	operations.CancelAll()
+
 	a.GetPersistence().Save()
 }
 
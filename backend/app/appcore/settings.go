@@ -1,7 +1,10 @@
 package appcore
 
 import (
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/fileutil"
 	"modm8/backend/common/paths"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -33,6 +36,12 @@ type GeneralOptions struct {
 type PerformanceOptions struct {
 	ThreadCount     uint8 `json:"thread_count" mapstructure:"thread_count"`
 	GPUAcceleration bool  `json:"gpu_acceleration" mapstructure:"gpu_acceleration"`
+	// How many mods can be downloaded at once. Anything beyond this waits in the download queue.
+	MaxConcurrentDownloads uint8 `json:"max_concurrent_downloads" mapstructure:"max_concurrent_downloads"`
+	// How fast all downloads combined can go, in KiB/s. 0 means unlimited.
+	DownloadRateLimit uint32 `json:"download_rate_limit" mapstructure:"download_rate_limit"`
+	// How fast each individual download can go, in KiB/s. 0 means unlimited.
+	PerDownloadRateLimit uint32 `json:"per_download_rate_limit" mapstructure:"per_download_rate_limit"`
 }
 
 type MiscOptions struct {
@@ -41,9 +50,37 @@ type MiscOptions struct {
 	GameSelectionLayout GameSelectionLayout `json:"game_selection_layout" mapstructure:"game_selection_layout"`
 }
 
+type ProfileOptions struct {
+	// How many snapshots to keep per profile before the oldest are deleted. 0 keeps every snapshot.
+	SnapshotRetention uint16 `json:"snapshot_retention" mapstructure:"snapshot_retention"`
+	// How mods are linked into new profiles. Auto picks the best mode the file system supports.
+	// Existing profiles keep using whichever mode they were linked with.
+	LinkMode fileutil.LinkMode `json:"link_mode" mapstructure:"link_mode"`
+}
+
+type GameStorageOptions struct {
+	// The title of the game with its original casing, since the key it is stored under is lowercased.
+	Title string `json:"title" mapstructure:"title"`
+	// Holds the Profiles and Snapshots dirs of the game.
+	GameDir     string `json:"game_dir" mapstructure:"game_dir"`
+	ModCacheDir string `json:"mod_cache_dir" mapstructure:"mod_cache_dir"`
+}
+
+// Where profiles and mods are stored. Empty paths use the defaults inside the config dir.
+//
+// These should only be changed through a move operation, otherwise existing profiles and mods will be left behind.
+type StorageOptions struct {
+	GamesDir    string `json:"games_dir" mapstructure:"games_dir"`
+	ModCacheDir string `json:"mod_cache_dir" mapstructure:"mod_cache_dir"`
+	// Per game overrides keyed by game title, taking priority over the above.
+	Games map[string]GameStorageOptions `json:"games" mapstructure:"games"`
+}
+
 type AppSettings struct {
 	General     GeneralOptions     `json:"general" mapstructure:"general"`
 	Performance PerformanceOptions `json:"performance" mapstructure:"performance"`
+	Profiles    ProfileOptions     `json:"profiles" mapstructure:"profiles"`
+	Storage     StorageOptions     `json:"storage" mapstructure:"storage"`
 	Misc        MiscOptions        `json:"misc" mapstructure:"misc"`
 }
 
@@ -56,8 +93,16 @@ func NewSettings() *AppSettings {
 			UpdateBehaviour:   UPDATE_BEHAVIOUR_AUTO,
 		},
 		Performance: PerformanceOptions{
-			ThreadCount:     NumCPU(),
-			GPUAcceleration: true,
+			ThreadCount:            NumCPU(),
+			GPUAcceleration:        true,
+			MaxConcurrentDownloads: downloader.DEFAULT_MAX_CONCURRENT_DOWNLOADS,
+		},
+		Profiles: ProfileOptions{
+			SnapshotRetention: 10,
+			LinkMode:          fileutil.LINK_MODE_AUTO,
+		},
+		Storage: StorageOptions{
+			Games: map[string]GameStorageOptions{},
 		},
 		Misc: MiscOptions{
 			SteamInstallPath:    nil,
@@ -89,6 +134,32 @@ func (settings *AppSettings) SaveAndApply() error {
 func (settings *AppSettings) Apply() {
 	// Set the max number of processes (OS threads) to the value from the settings.toml file.
 	SetMaxProcs(settings.Performance.ThreadCount)
+
+	// Settings from before this option existed will have it unset.
+	maxDownloads := settings.Performance.MaxConcurrentDownloads
+	if maxDownloads == 0 {
+		maxDownloads = downloader.DEFAULT_MAX_CONCURRENT_DOWNLOADS
+	}
+
+	downloader.Queue.SetMaxConcurrent(int(maxDownloads))
+	downloader.SetRateLimits(
+		int64(settings.Performance.DownloadRateLimit)*1024,
+		int64(settings.Performance.PerDownloadRateLimit)*1024,
+	)
+
+	// Point profiles and the mod cache at wherever the user has moved them.
+	games := make(map[string]paths.GameStorageOverrides, len(settings.Storage.Games))
+	for title, game := range settings.Storage.Games {
+		games[title] = paths.GameStorageOverrides{Title: game.Title, GameDir: game.GameDir, ModCacheDir: game.ModCacheDir}
+	}
+
+	paths.SetStorageOverrides(paths.StorageOverrides{
+		GamesDir:    settings.Storage.GamesDir,
+		ModCacheDir: settings.Storage.ModCacheDir,
+		Games:       games,
+	})
+
+	fileutil.SetPreferredLinkMode(settings.Profiles.LinkMode)
 }
 
 func (settings *AppSettings) SetLocale(locale string) {
@@ -115,6 +186,60 @@ func (settings *AppSettings) SetGPUAccel(val bool) {
 	settings.Performance.GPUAcceleration = val
 }
 
+func (settings *AppSettings) SetMaxConcurrentDownloads(count uint8) {
+	settings.Performance.MaxConcurrentDownloads = count
+}
+
+// Sets the combined download rate limit in KiB/s. 0 means unlimited.
+func (settings *AppSettings) SetDownloadRateLimit(kibPerSecond uint32) {
+	settings.Performance.DownloadRateLimit = kibPerSecond
+}
+
+// Sets the rate limit of each individual download in KiB/s. 0 means unlimited.
+func (settings *AppSettings) SetPerDownloadRateLimit(kibPerSecond uint32) {
+	settings.Performance.PerDownloadRateLimit = kibPerSecond
+}
+
+func (settings *AppSettings) SetSnapshotRetention(count uint16) {
+	settings.Profiles.SnapshotRetention = count
+}
+
+func (settings *AppSettings) SetLinkMode(mode fileutil.LinkMode) {
+	settings.Profiles.LinkMode = mode
+}
+
+// Only records where profiles live, without moving anything. Not a method so it isn't bound to the frontend,
+// as changing the location alone would strand every profile in the old one. Use profile.MoveGamesDir instead.
+func SetGamesDir(settings *AppSettings, path string) {
+	settings.Storage.GamesDir = path
+}
+
+// Only records where the mod cache lives. Not bound for the same reason as [SetGamesDir]. Use profile.MoveModCacheDir instead.
+func SetModCacheDir(settings *AppSettings, path string) {
+	settings.Storage.ModCacheDir = path
+}
+
+// Only records where a single game's data lives. Not bound for the same reason as [SetGamesDir].
+func SetGameStorage(settings *AppSettings, gameTitle string, storage GameStorageOptions) {
+	if settings.Storage.Games == nil {
+		settings.Storage.Games = map[string]GameStorageOptions{}
+	}
+
+	// Lowercased to match what the settings file does to its keys when loaded.
+	key := strings.ToLower(gameTitle)
+	if storage.GameDir == "" && storage.ModCacheDir == "" {
+		delete(settings.Storage.Games, key)
+		return
+	}
+
+	storage.Title = gameTitle
+	settings.Storage.Games[key] = storage
+}
+
+func (settings *AppSettings) GetGameStorage(gameTitle string) GameStorageOptions {
+	return settings.Storage.Games[strings.ToLower(gameTitle)]
+}
+
 func (settings *AppSettings) SetSteamInstallPath(path string) {
 	settings.Misc.SteamInstallPath = &path
 }
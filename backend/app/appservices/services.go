@@ -2,6 +2,8 @@ package appservices
 
 import (
 	"modm8/backend/app/appcore"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/operations"
 	"modm8/backend/game"
 	"modm8/backend/launchers/steam"
 	"modm8/backend/profile"
@@ -15,19 +17,25 @@ type AppServices struct {
 	TSAPI          *thunderstore.ThunderstoreAPI
 	TSSchema       *thunderstore.ThunderstoreSchema
 	TSDevTools     *thunderstore.ThunderstoreDevTools
+	Operations     *operations.OperationManager
+	DownloadQueue  *downloader.QueueService
 }
 
 func New(core *appcore.AppCore) *AppServices {
 	services := &AppServices{
-		GameManager:    game.NewGameManager(),
-		ProfileManager: profile.NewProfileManager(),
+		GameManager:    game.NewGameManager(core.Settings),
+		ProfileManager: profile.NewProfileManager(core.Settings),
 		SteamLauncher:  steam.NewSteamLauncher(core.Settings),
 		TSAPI:          thunderstore.NewThunderstoreAPI(),
 		TSSchema:       thunderstore.NewThunderstoreSchema(),
 		TSDevTools:     thunderstore.NewThunderstoreDevTools(),
+		Operations:     operations.NewOperationManager(),
+		DownloadQueue:  downloader.NewQueueService(),
 	}
 
 	services.TSAPI.SetSchema(services.TSSchema)
+	services.GameManager.SetPackageValidator(services.TSDevTools.PackageValidator)
+	services.ProfileManager.SetPackageValidator(services.TSDevTools.PackageValidator)
 
 	return services
 }
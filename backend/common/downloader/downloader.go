@@ -1,12 +1,14 @@
 package downloader
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"modm8/backend/common/fileutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/cavaliergopher/grab/v3"
 	"golang.org/x/sync/errgroup"
@@ -102,37 +104,161 @@ func DownloadMultipleFiles(destPath string, pool DownloadPool) (map[string]error
 	return errs, nil
 }
 
+// Downloads a zip to filePath (with [CUSTOM_ZIP_EXT] appended), blocking until complete.
+// Interrupted downloads are resumed and transient errors retried. See [DownloadFileResumable].
 func DownloadZip(url, filePath string) (*grab.Response, error) {
 	dir, file := filepath.Split(filePath)
 	fi := fileutil.NewFileInfo(dir, file, CUSTOM_ZIP_EXT)
 
-	return DownloadFile(url, dir, fi)
+	return DownloadFileResumable(context.Background(), url, dir, fi, DefaultRetryPolicy)
+}
+
+// Extra behaviour for [DownloadAndUnzipOpts].
+type DownloadOptions struct {
+	// Deletes the leftover zip once it has been extracted (or failed to be).
+	DeleteArchive bool
+	// The size in bytes the downloaded zip must be. 0 skips the check.
+	ExpectedSize int64
+	// The hex encoded SHA-256 hash the downloaded zip must have. Empty skips the check.
+	ExpectedSHA256 string
+	// Called with the path to the downloaded zip before it is extracted, such as to hash it.
+	// Only called once the zip has passed verification. Returning an error stops the extraction.
+	BeforeExtract func(archivePath string) error
+	// Called with the path to the staging dir the zip was extracted into, before it is moved into place.
+	// Anything that should be validated or normalized before the result becomes visible belongs here.
+	// Returning an error stops it from being moved into place.
+	BeforeCommit func(stagingPath string) error
+	// Where progress is reported as the zip is downloaded, verified and extracted. Finishing it is left to the caller.
+	Progress *ProgressTask
+	// Called before anything is downloaded, such as to record that an install has started. Returning an error stops the download.
+	//
+	// Like every other option, it is only used by the caller whose job ends up running (see [DownloadAndUnzipContext]),
+	// so it also tells that caller apart from any that joined the job.
+	Prepare func() error
+	// Called once the job is done with the error it ended with (nil on success), and returns the error it should end with instead.
+	// Only called if Prepare succeeded. ctx is that of the job, which is only cancelled once nobody is waiting on it anymore,
+	// so this is where anything Prepare started should be cleaned up rather than after the call returns.
+	Finish func(ctx context.Context, err error) error
 }
 
 // Downloads, unzips contents as is at filePath. If delete is true, the leftover zip will be subsequently deleted.
 func DownloadAndUnzip(url, filePath string, delete bool) (*grab.Response, error) {
+	return DownloadAndUnzipOpts(url, filePath, DownloadOptions{DeleteArchive: delete})
+}
+
+// Same as [DownloadAndUnzip], but with extra options. See [DownloadOptions].
+func DownloadAndUnzipOpts(url, filePath string, opts DownloadOptions) (*grab.Response, error) {
+	return DownloadAndUnzipContext(context.Background(), url, filePath, opts)
+}
+
+// Same as [DownloadAndUnzipOpts], but both the download and extraction stop as soon as ctx is cancelled.
+// The zip is checked against any expected size or hash in opts before extraction, returning a [VerificationError] if it doesn't match.
+//
+// Despite the name, the archive can be in any format supported by [fileutil.ExtractArchive], not only zip.
+// It is extracted into a staging dir and only renamed to filePath once complete, so filePath never holds
+// a partial extraction. See [fileutil.NewStagingDir].
+//
+// Goes through the download [Queue] at the priority set on ctx (see [WithPriority]). If the same URL is already being
+// downloaded to the same path, this waits for it to finish instead, in which case opts and the response are not used.
+// Any checks of the result the caller needs (such as its own expected hash) must then be done after this returns.
+func DownloadAndUnzipContext(ctx context.Context, url, filePath string, opts DownloadOptions) (*grab.Response, error) {
 	dir, file := filepath.Split(filePath)
 	if exists, _ := fileutil.ExistsInDir(dir, file); exists {
 		return nil, fmt.Errorf("package '%s' already installed in %s", file, dir)
 	}
 
-	resp, err := DownloadZip(url, filePath)
-	if err != nil {
+	// The job may outlive this call if ctx is cancelled while others still wait on it, hence the atomic.
+	var resp atomic.Pointer[grab.Response]
+	err := Queue.Do(ctx, url+"\n"+filepath.Clean(filePath), PriorityFromContext(ctx), func(ctx context.Context) error {
+		if opts.Prepare != nil {
+			if err := opts.Prepare(); err != nil {
+				return err
+			}
+		}
+
+		res, err := downloadAndUnzip(ctx, url, filePath, opts)
+		resp.Store(res)
+
+		if opts.Finish != nil {
+			err = opts.Finish(ctx, err)
+		}
+
+		return err
+	})
+
+	return resp.Load(), err
+}
+
+func downloadAndUnzip(ctx context.Context, url, filePath string, opts DownloadOptions) (*grab.Response, error) {
+	dir, file := filepath.Split(filePath)
+
+	// A finished zip may have been left behind if the app closed before it could be extracted, no need to download it again.
+	// If it turns out to be bad, extracting it fails and it gets deleted so the next attempt starts fresh.
+	// There is no response in this case, since nothing was downloaded.
+	var resp *grab.Response
+	archivePath := filePath + CUSTOM_ZIP_EXT
+
+	if exists, _ := fileutil.ExistsAtPath(archivePath); !exists {
+		var err error
+		fi := fileutil.NewFileInfo(dir, file, CUSTOM_ZIP_EXT)
+
+		resp, err = downloadResumable(ctx, url, dir, fi, DefaultRetryPolicy, opts.Progress)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	// A bad zip is always deleted, whether or not it was asked for, otherwise it would be picked up again by the next attempt.
+	opts.Progress.SetPhase(PHASE_VERIFY)
+	if err := VerifyArchive(archivePath, opts.ExpectedSize, opts.ExpectedSHA256); err != nil {
+		os.Remove(archivePath)
 		return resp, err
 	}
-	if err = resp.Err(); err != nil {
+
+	if opts.BeforeExtract != nil {
+		if err := opts.BeforeExtract(archivePath); err != nil {
+			if opts.DeleteArchive {
+				os.Remove(archivePath)
+			}
+
+			return resp, err
+		}
+	}
+
+	stagingPath, err := fileutil.NewStagingDir(filePath)
+	if err != nil {
 		return resp, err
 	}
 
-	// TODO: If the program closes for any reason, we need to be able to cancel (and possibly resume)
-	// 		 installing the current zip, then also ensure it is deleted. Maybe when user next opens app?
+	// Does nothing once it has been moved into place.
+	defer os.RemoveAll(stagingPath)
+
+	// Extract the package, whichever archive format it came in, to be moved to the path (usually the current mod cache dir).
+	opts.Progress.SetPhase(PHASE_EXTRACT)
+	var progress fileutil.ExtractProgressFunc
+	if opts.Progress != nil {
+		progress = opts.Progress.ReportExtract
+	}
+
+	err = fileutil.ExtractArchiveContext(ctx, archivePath, stagingPath, progress)
+	if opts.DeleteArchive {
+		os.Remove(archivePath)
+	}
 
-	// Unzip the package to the path (usually the current mod cache dir).
-	err = fileutil.Unzip(filePath+CUSTOM_ZIP_EXT, filePath, delete)
 	if err != nil {
 		return resp, err
 	}
 
+	if opts.BeforeCommit != nil {
+		if err := opts.BeforeCommit(stagingPath); err != nil {
+			return resp, err
+		}
+	}
+
+	if err := fileutil.CommitStagingDir(stagingPath, filePath); err != nil {
+		return resp, fmt.Errorf("failed to move extracted package into place:\n%v", err)
+	}
+
 	return resp, nil
 }
 
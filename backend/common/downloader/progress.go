@@ -0,0 +1,235 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cavaliergopher/grab/v3"
+)
+
+// Names of the events progress is emitted under. See [SetProgressHandler].
+const (
+	PROGRESS_EVENT           = "download:progress"
+	AGGREGATE_PROGRESS_EVENT = "download:aggregate"
+)
+
+// How often progress is reported while a download is transferring.
+const PROGRESS_INTERVAL = 250 * time.Millisecond
+
+type ProgressPhase string
+
+const (
+	PHASE_DOWNLOAD ProgressPhase = "download"
+	PHASE_VERIFY   ProgressPhase = "verify"
+	PHASE_EXTRACT  ProgressPhase = "extract"
+	PHASE_LINK     ProgressPhase = "link"
+	PHASE_DONE     ProgressPhase = "done"
+	PHASE_FAILED   ProgressPhase = "failed"
+)
+
+// The progress of a single package, keyed by its full name.
+type ProgressEvent struct {
+	FullName      string        `json:"full_name"`
+	Phase         ProgressPhase `json:"phase"`
+	BytesComplete int64         `json:"bytes_complete"`
+	// -1 when the server didn't say how big the file is.
+	TotalBytes     int64   `json:"total_bytes"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	// Estimated seconds left until the download finishes. 0 when unknown or not downloading.
+	ETASeconds float64 `json:"eta_seconds"`
+	// How much of the archive has been extracted so far, kept apart from the download so it doesn't skew the aggregate.
+	ExtractedBytes int64 `json:"extracted_bytes,omitempty"`
+	// -1 when the archive format doesn't say how big its contents are up front.
+	ExtractTotalBytes int64 `json:"extract_total_bytes,omitempty"`
+	// Only set when the phase is [PHASE_FAILED].
+	Error string `json:"error,omitempty"`
+}
+
+// The combined progress of every package since the last time nothing was in progress.
+type AggregateProgress struct {
+	Active         int     `json:"active"`
+	Completed      int     `json:"completed"`
+	Failed         int     `json:"failed"`
+	BytesComplete  int64   `json:"bytes_complete"`
+	TotalBytes     int64   `json:"total_bytes"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ETASeconds     float64 `json:"eta_seconds"`
+}
+
+// Receives every progress update along with the aggregate progress at that moment.
+type ProgressHandler func(event ProgressEvent, aggregate AggregateProgress)
+
+var (
+	progressMutex   sync.Mutex
+	progressHandler ProgressHandler
+	progressTasks   = map[string]*ProgressTask{}
+)
+
+// Sets the function each progress event and the new totals are passed to. Only one can be set at a time; nil stops reporting.
+func SetProgressHandler(handler ProgressHandler) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	progressHandler = handler
+}
+
+// Tracks the progress of a single package through each phase of being installed.
+type ProgressTask struct {
+	event ProgressEvent
+}
+
+// Returns the task tracking the package with the given full name, starting one if it isn't already being tracked.
+//
+// Reports whether the task was started by this call, in which case the caller is responsible for calling [ProgressTask.Finish].
+// This lets outer steps (like linking) own a task that inner steps (like downloading) also report to.
+func TrackProgress(fullName string) (*ProgressTask, bool) {
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	if task, ok := progressTasks[fullName]; ok && !task.finished() {
+		return task, false
+	}
+
+	task := &ProgressTask{event: ProgressEvent{FullName: fullName, Phase: PHASE_DOWNLOAD, TotalBytes: -1}}
+	progressTasks[fullName] = task
+
+	return task, true
+}
+
+// Moves the task on to the given phase and reports it.
+func (task *ProgressTask) SetPhase(phase ProgressPhase) {
+	if task == nil {
+		return
+	}
+
+	task.update(func(event *ProgressEvent) {
+		event.Phase = phase
+		event.BytesPerSecond = 0
+		event.ETASeconds = 0
+	})
+}
+
+// Reports the progress of a download every [PROGRESS_INTERVAL], blocking until it is done.
+func (task *ProgressTask) Track(res *grab.Response) {
+	if task == nil || res == nil {
+		return
+	}
+
+	ticker := time.NewTicker(PROGRESS_INTERVAL)
+	defer ticker.Stop()
+
+	report := func() {
+		task.update(func(event *ProgressEvent) {
+			event.Phase = PHASE_DOWNLOAD
+			event.BytesComplete = res.BytesComplete()
+			event.TotalBytes = res.Size()
+			event.BytesPerSecond = res.BytesPerSecond()
+			event.ETASeconds = 0
+
+			if eta := time.Until(res.ETA()); eta > 0 && !res.IsComplete() {
+				event.ETASeconds = eta.Seconds()
+			}
+		})
+	}
+
+	for {
+		select {
+		case <-res.Done:
+			report()
+			return
+		case <-ticker.C:
+			report()
+		}
+	}
+}
+
+// Reports how far along extracting the archive is. Matches the progress func taken by the extractor.
+func (task *ProgressTask) ReportExtract(written, total int64) {
+	if task == nil {
+		return
+	}
+
+	task.update(func(event *ProgressEvent) {
+		event.Phase = PHASE_EXTRACT
+		event.ExtractedBytes = written
+		event.ExtractTotalBytes = total
+	})
+}
+
+// Marks the task as done, or failed if err is not nil. Finished tasks count towards the aggregate until nothing is left in progress.
+func (task *ProgressTask) Finish(err error) {
+	if task == nil {
+		return
+	}
+
+	task.update(func(event *ProgressEvent) {
+		event.BytesPerSecond = 0
+		event.ETASeconds = 0
+
+		if err != nil {
+			event.Phase = PHASE_FAILED
+			event.Error = err.Error()
+			return
+		}
+
+		event.Phase = PHASE_DONE
+	})
+}
+
+func (task *ProgressTask) finished() bool {
+	return task.event.Phase == PHASE_DONE || task.event.Phase == PHASE_FAILED
+}
+
+// Applies fn to the task's event while holding the progress lock, then reports it.
+func (task *ProgressTask) update(fn func(event *ProgressEvent)) {
+	progressMutex.Lock()
+
+	fn(&task.event)
+
+	event := task.event
+	handler := progressHandler
+	aggregate := aggregateProgress()
+
+	if aggregate.Active == 0 {
+		// Everything has finished, so the next batch starts from a clean slate.
+		clear(progressTasks)
+	}
+
+	progressMutex.Unlock()
+
+	// Called without the lock so the handler is free to take its time.
+	if handler != nil {
+		handler(event, aggregate)
+	}
+}
+
+// Combines every tracked task. Must be called while holding the progress lock.
+func aggregateProgress() AggregateProgress {
+	aggregate := AggregateProgress{}
+
+	for _, task := range progressTasks {
+		event := task.event
+
+		switch event.Phase {
+		case PHASE_DONE:
+			aggregate.Completed++
+		case PHASE_FAILED:
+			aggregate.Failed++
+		default:
+			aggregate.Active++
+		}
+
+		aggregate.BytesComplete += event.BytesComplete
+		if event.TotalBytes > 0 {
+			aggregate.TotalBytes += event.TotalBytes
+		}
+
+		aggregate.BytesPerSecond += event.BytesPerSecond
+	}
+
+	if remaining := aggregate.TotalBytes - aggregate.BytesComplete; remaining > 0 && aggregate.BytesPerSecond > 0 {
+		aggregate.ETASeconds = float64(remaining) / aggregate.BytesPerSecond
+	}
+
+	return aggregate
+}
@@ -0,0 +1,286 @@
+package downloader
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// How many downloads run at once unless the settings say otherwise.
+const DEFAULT_MAX_CONCURRENT_DOWNLOADS = 3
+
+// Decides which queued downloads start first. Higher goes first, ties go in the order they were queued.
+type DownloadPriority int8
+
+const (
+	// Bulk work that can wait behind individual installs, such as repairing, restoring or importing a profile.
+	PRIORITY_BACKGROUND DownloadPriority = -1
+	PRIORITY_NORMAL     DownloadPriority = 0
+	// Things the user is actively waiting on, such as clicking install.
+	PRIORITY_USER DownloadPriority = 1
+)
+
+type priorityKey struct{}
+
+// Returns a copy of ctx that queues any download made with it at the given priority.
+func WithPriority(ctx context.Context, priority DownloadPriority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// Returns the priority set by [WithPriority], or [PRIORITY_NORMAL] if there isn't one.
+func PriorityFromContext(ctx context.Context) DownloadPriority {
+	if priority, ok := ctx.Value(priorityKey{}).(DownloadPriority); ok {
+		return priority
+	}
+
+	return PRIORITY_NORMAL
+}
+
+type QueueStatus struct {
+	Paused        bool `json:"paused"`
+	Running       int  `json:"running"`
+	Queued        int  `json:"queued"`
+	MaxConcurrent int  `json:"max_concurrent"`
+}
+
+// Coordinates every download so only so many run at once, the most important go first and the same one never runs twice at the same time.
+type DownloadQueue struct {
+	mutex         sync.Mutex
+	maxConcurrent int
+	running       int
+	paused        bool
+	seq           uint64
+	waiting       jobHeap
+	// Every queued or running job, keyed by what it downloads.
+	jobs map[string]*queueJob
+}
+
+type queueJob struct {
+	key      string
+	priority DownloadPriority
+	seq      uint64
+	// Position in the heap, maintained by [jobHeap].
+	index int
+
+	fn      func(ctx context.Context) error
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+	started bool
+
+	done chan struct{}
+	err  error
+}
+
+// The queue every download goes through.
+var Queue = NewDownloadQueue(DEFAULT_MAX_CONCURRENT_DOWNLOADS)
+
+func NewDownloadQueue(maxConcurrent int) *DownloadQueue {
+	return &DownloadQueue{
+		maxConcurrent: max(maxConcurrent, 1),
+		jobs:          map[string]*queueJob{},
+	}
+}
+
+// Queues fn under the given key and blocks until it has run, returning its error.
+//
+// If a job with the same key is already queued or running, fn is dropped and this waits on that job instead, sharing its result.
+// Joining a queued job with a higher priority bumps it up the queue.
+//
+// The job gets its own context, which is only cancelled once every caller waiting on it has had their ctx cancelled.
+// A caller that gives up early gets its ctx error without affecting anyone else waiting on the same job.
+// If it was the last one waiting, the job is cancelled and this returns once it has finished.
+func (q *DownloadQueue) Do(ctx context.Context, key string, priority DownloadPriority, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+
+	job, ok := q.jobs[key]
+	if !ok {
+		jobCtx, cancel := context.WithCancel(context.Background())
+		job = &queueJob{
+			key:      key,
+			priority: priority,
+			seq:      q.seq,
+			fn:       fn,
+			ctx:      jobCtx,
+			cancel:   cancel,
+			done:     make(chan struct{}),
+		}
+
+		q.seq++
+		q.jobs[key] = job
+		heap.Push(&q.waiting, job)
+	} else if !job.started && priority > job.priority {
+		job.priority = priority
+		heap.Fix(&q.waiting, job.index)
+	}
+
+	job.waiters++
+	q.schedule()
+	q.mutex.Unlock()
+
+	select {
+	case <-job.done:
+		return job.err
+	case <-ctx.Done():
+		// Whatever the job does to clean up after being cancelled should be done by the time the last caller hears about it.
+		if q.leave(job, ctx.Err()) {
+			<-job.done
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Stops queued downloads from starting until [DownloadQueue.Resume] is called. Downloads that already started are left to finish.
+func (q *DownloadQueue) Pause() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.paused = true
+}
+
+func (q *DownloadQueue) Resume() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.paused = false
+	q.schedule()
+}
+
+// Changes how many downloads can run at once. Lowering it never stops downloads that are already running.
+func (q *DownloadQueue) SetMaxConcurrent(count int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.maxConcurrent = max(count, 1)
+	q.schedule()
+}
+
+func (q *DownloadQueue) Status() QueueStatus {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return QueueStatus{
+		Paused:        q.paused,
+		Running:       q.running,
+		Queued:        q.waiting.Len(),
+		MaxConcurrent: q.maxConcurrent,
+	}
+}
+
+// Starts as many queued jobs as allowed. Must be called while holding the queue lock.
+func (q *DownloadQueue) schedule() {
+	for !q.paused && q.running < q.maxConcurrent && q.waiting.Len() > 0 {
+		job := heap.Pop(&q.waiting).(*queueJob)
+		job.started = true
+		q.running++
+
+		go q.run(job)
+	}
+}
+
+func (q *DownloadQueue) run(job *queueJob) {
+	err := job.fn(job.ctx)
+	job.cancel()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.running--
+	q.finish(job, err)
+	q.schedule()
+}
+
+// Stops waiting on a job. If nobody else is waiting on it either, it is cancelled (or dropped if it hasn't started yet).
+// Reports whether a running job was cancelled, which is still winding down until its done chan closes.
+func (q *DownloadQueue) leave(job *queueJob, err error) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job.waiters--
+	if job.waiters > 0 {
+		return false
+	}
+
+	job.cancel()
+
+	if !job.started && job.index >= 0 {
+		heap.Remove(&q.waiting, job.index)
+		q.finish(job, err)
+		return false
+	}
+
+	return true
+}
+
+// Must be called while holding the queue lock.
+func (q *DownloadQueue) finish(job *queueJob, err error) {
+	if q.jobs[job.key] == job {
+		delete(q.jobs, job.key)
+	}
+
+	job.err = err
+	close(job.done)
+}
+
+// Orders jobs by priority (highest first), then by the order they were queued in. See [container/heap].
+type jobHeap []*queueJob
+
+func (h jobHeap) Len() int {
+	return len(h)
+}
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x any) {
+	job := x.(*queueJob)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+
+	job := old[n-1]
+	old[n-1] = nil
+	job.index = -1
+
+	*h = old[:n-1]
+	return job
+}
+
+// Lets the frontend pause, resume and inspect the download queue.
+type QueueService struct{}
+
+func NewQueueService() *QueueService {
+	return &QueueService{}
+}
+
+func (qs *QueueService) PauseDownloads() {
+	Queue.Pause()
+}
+
+func (qs *QueueService) ResumeDownloads() {
+	Queue.Resume()
+}
+
+func (qs *QueueService) GetQueueStatus() QueueStatus {
+	return Queue.Status()
+}
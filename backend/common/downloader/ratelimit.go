@@ -0,0 +1,148 @@
+package downloader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cavaliergopher/grab/v3"
+)
+
+// Limits how fast bytes can flow, refilling at a steady rate up to one second's worth.
+// A rate of 0 means unlimited. Implements [grab.RateLimiter].
+//
+// Asking for more than is available puts the bucket into debt, which later callers wait out,
+// so a single large read never blocks forever and the average rate still holds.
+type TokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	// Closed and replaced whenever the rate changes, waking anyone waiting on the old rate.
+	changed chan struct{}
+}
+
+func NewTokenBucket(bytesPerSecond int64) *TokenBucket {
+	bucket := &TokenBucket{changed: make(chan struct{})}
+	bucket.SetRate(bytesPerSecond)
+
+	return bucket
+}
+
+// Changes the rate, taking effect immediately. The current balance is kept, only clamped to what the new rate can hold.
+// Anyone waiting is let through so they pick up the new rate on their next read.
+func (b *TokenBucket) SetRate(bytesPerSecond int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if float64(max(bytesPerSecond, 0)) == b.rate {
+		return
+	}
+
+	rate := float64(max(bytesPerSecond, 0))
+	now := time.Now()
+
+	// Keep whatever balance (or debt) built up at the old rate, so changing the rate can't be used to skip a wait.
+	// Coming from unlimited there is no balance to keep, so the bucket starts full.
+	if b.rate > 0 {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, rate)
+	} else {
+		b.tokens = rate
+	}
+
+	b.rate = rate
+	b.last = now
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *TokenBucket) Rate() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return int64(b.rate)
+}
+
+// Takes n tokens from the bucket, blocking until they have been paid for or ctx is cancelled.
+func (b *TokenBucket) WaitN(ctx context.Context, n int) error {
+	b.mutex.Lock()
+
+	if b.rate <= 0 {
+		b.mutex.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	changed := b.changed
+
+	b.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Applies every limiter in turn, so the slowest one wins.
+type chainLimiter []grab.RateLimiter
+
+func (limiters chainLimiter) WaitN(ctx context.Context, n int) error {
+	for _, limiter := range limiters {
+		if err := limiter.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Keeps its own bucket, but follows the per transfer rate so changes apply to transfers that are already running.
+type transferLimiter struct {
+	bucket *TokenBucket
+}
+
+func (limiter *transferLimiter) WaitN(ctx context.Context, n int) error {
+	limiter.bucket.SetRate(perTransferRate.Load())
+	return limiter.bucket.WaitN(ctx, n)
+}
+
+var (
+	// Shared by every download, so they can't go beyond this combined.
+	globalLimiter   = NewTokenBucket(0)
+	perTransferRate atomic.Int64
+)
+
+// Sets how fast downloads can go, in bytes per second. The global limit is shared by every download combined,
+// while the per transfer limit applies to each individually. 0 means unlimited.
+//
+// Takes effect immediately, including for downloads that are already running.
+func SetRateLimits(globalBytesPerSecond, perTransferBytesPerSecond int64) {
+	globalLimiter.SetRate(globalBytesPerSecond)
+	perTransferRate.Store(max(perTransferBytesPerSecond, 0))
+}
+
+// Returns the limiter a new transfer should use, combining the global and per transfer limits.
+func newTransferLimiter() grab.RateLimiter {
+	return chainLimiter{
+		globalLimiter,
+		&transferLimiter{bucket: NewTokenBucket(perTransferRate.Load())},
+	}
+}
@@ -0,0 +1,205 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"modm8/backend/common/fileutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cavaliergopher/grab/v3"
+)
+
+// Appended to the output path while a download is in progress. Only renamed to the real path once complete,
+// so a partial file is never mistaken for a finished one and can be resumed from where it left off.
+const PARTIAL_EXT = ".part"
+
+// Partial downloads that haven't been written to for this long are considered abandoned. See [CleanupPartialDownloads].
+const PARTIAL_MAX_AGE = 72 * time.Hour
+
+// Decides how many times a failed download is retried and how long to wait between each attempt.
+type RetryPolicy struct {
+	// Total number of attempts, including the first. 0 or 1 means no retries.
+	MaxAttempts uint8
+	// The delay before the first retry, doubled for each one after.
+	BaseDelay time.Duration
+	// The delay never grows beyond this.
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Returns how long to wait before the given retry (starting at 0).
+//
+// The delay grows exponentially but is randomised between half and all of it (jitter),
+// so many downloads failing at once don't all retry at the exact same moment.
+func (policy RetryPolicy) Backoff(retry int) time.Duration {
+	delay := policy.BaseDelay
+	if retry > 0 {
+		// Checked before shifting, as shifting far enough overflows into a negative delay.
+		if delay > policy.MaxDelay>>retry {
+			delay = policy.MaxDelay
+		} else {
+			delay <<= retry
+		}
+	}
+
+	delay = min(delay, policy.MaxDelay)
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// Reports whether a download error is likely to go away by itself, such as a dropped connection or an overloaded server.
+// Anything else (404, disk full etc.) will fail the same way again, so retrying it is pointless.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusErr grab.StatusCodeError
+	if errors.As(err, &statusErr) {
+		code := int(statusErr)
+		return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// Like [DownloadFile], but blocks until the download completes, retrying transient errors according to the given policy.
+//
+// The file is downloaded next to the output path with [PARTIAL_EXT] appended, and only renamed once complete.
+// If a partial file is already there (from an interrupted attempt, even in a previous session),
+// the download continues from where it left off using a HTTP Range request, as long as the server supports it.
+//
+// Cancelling ctx aborts the transfer and deletes the partial file, since the download is no longer wanted.
+// The transfer is held to the limits set by [SetRateLimits].
+func DownloadFileResumable(ctx context.Context, url, dirPath string, fi fileutil.FileMetadata, policy RetryPolicy) (*grab.Response, error) {
+	return downloadResumable(ctx, url, dirPath, fi, policy, nil)
+}
+
+// Same as [DownloadFileResumable], reporting the progress of each attempt to the given task (if any).
+func downloadResumable(ctx context.Context, url, dirPath string, fi fileutil.FileMetadata, policy RetryPolicy, task *ProgressTask) (*grab.Response, error) {
+	outputPath := filepath.Join(filepath.Clean(dirPath), fi.NameAndExt())
+	if exists, _ := fileutil.ExistsAtPath(outputPath); exists {
+		return nil, fmt.Errorf("file/dir already exists: %s", outputPath)
+	}
+
+	partPath := outputPath + PARTIAL_EXT
+	client := grab.NewClient()
+	limiter := newTransferLimiter()
+
+	var res *grab.Response
+	for attempt := 1; ; attempt++ {
+		req, err := grab.NewRequest(partPath, url)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+
+		req.RateLimiter = limiter
+		res = client.Do(req.WithContext(ctx))
+		task.Track(res)
+
+		err = res.Err()
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			os.Remove(partPath)
+			return res, ctx.Err()
+		}
+
+		// The partial file is bigger than the remote one, so it must belong to a different file. Start over.
+		if errors.Is(err, grab.ErrBadLength) {
+			os.Remove(partPath)
+		} else if !IsTransientError(err) {
+			return res, err
+		}
+
+		if attempt >= int(policy.MaxAttempts) {
+			return res, fmt.Errorf("download failed after %d attempts:\n%v", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			os.Remove(partPath)
+			return res, ctx.Err()
+		case <-time.After(policy.Backoff(attempt - 1)):
+		}
+	}
+
+	if err := os.Rename(partPath, outputPath); err != nil {
+		return res, fmt.Errorf("error finalizing download: %v", err)
+	}
+
+	return res, nil
+}
+
+// Deletes partial downloads directly inside each of the given dirs that haven't been written to within maxAge,
+// since whatever was downloading them is long gone. Recent ones are left alone so they can still be resumed.
+//
+// Returns how many were deleted.
+func CleanupPartialDownloads(dirs []string, maxAge time.Duration) (int, error) {
+	count := 0
+	var errBuilder strings.Builder
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+			continue
+		}
+
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), PARTIAL_EXT) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < maxAge {
+				continue
+			}
+
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				errBuilder.WriteString(err.Error() + "\n")
+				continue
+			}
+
+			count++
+		}
+	}
+
+	if errBuilder.Len() > 0 {
+		return count, fmt.Errorf("errors occurred cleaning up partial downloads:\n%s", errBuilder.String())
+	}
+
+	return count, nil
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Matched by every [VerificationError], so callers can check for a bad download with [errors.Is].
+var ErrCorruptDownload = errors.New("downloaded archive is corrupt or incomplete")
+
+type VerificationCheck string
+
+const (
+	VERIFY_SIZE   VerificationCheck = "SIZE"
+	VERIFY_SHA256 VerificationCheck = "SHA256"
+)
+
+// Returned when a downloaded archive doesn't match what it was expected to be, such as being truncated or corrupted in transit.
+type VerificationError struct {
+	ArchivePath string
+	Check       VerificationCheck
+	Expected    string
+	Actual      string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%s check failed for %s. expected %s, got %s", e.Check, e.ArchivePath, e.Expected, e.Actual)
+}
+
+func (e *VerificationError) Is(target error) bool {
+	return target == ErrCorruptDownload
+}
+
+// Checks the archive at the given path against its expected size in bytes and hex encoded SHA-256 hash,
+// returning a [VerificationError] on the first that doesn't match. Zero values are not checked.
+func VerifyArchive(archivePath string, expectedSize int64, expectedSHA256 string) error {
+	if expectedSize > 0 {
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			return err
+		}
+
+		if info.Size() != expectedSize {
+			return &VerificationError{
+				ArchivePath: archivePath,
+				Check:       VERIFY_SIZE,
+				Expected:    strconv.FormatInt(expectedSize, 10),
+				Actual:      strconv.FormatInt(info.Size(), 10),
+			}
+		}
+	}
+
+	if expectedSHA256 != "" {
+		hash, err := fileutil.HashFile(archivePath)
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(hash, expectedSHA256) {
+			return &VerificationError{
+				ArchivePath: archivePath,
+				Check:       VERIFY_SHA256,
+				Expected:    strings.ToLower(expectedSHA256),
+				Actual:      hash,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,404 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/nwaples/rardecode/v2"
+)
+
+type ArchiveFormat string
+
+const (
+	ARCHIVE_FORMAT_ZIP    ArchiveFormat = "zip"
+	ARCHIVE_FORMAT_7Z     ArchiveFormat = "7z"
+	ARCHIVE_FORMAT_RAR    ArchiveFormat = "rar"
+	ARCHIVE_FORMAT_TAR_GZ ArchiveFormat = "tar.gz"
+)
+
+// How often progress is reported while an archive is extracted.
+const EXTRACT_PROGRESS_INTERVAL = 250 * time.Millisecond
+
+// Called while an archive is extracted with how many bytes have been written so far, out of how many in total.
+// The total is -1 if the format doesn't record it up front.
+type ExtractProgressFunc func(written, total int64)
+
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+// Identifiable by the first few bytes of the file, regardless of its extension.
+var archiveSignatures = []struct {
+	format    ArchiveFormat
+	signature []byte
+}{
+	{ARCHIVE_FORMAT_ZIP, []byte("PK\x03\x04")},
+	// An empty zip, which is just the end of central directory record.
+	{ARCHIVE_FORMAT_ZIP, []byte("PK\x05\x06")},
+	{ARCHIVE_FORMAT_7Z, []byte("7z\xBC\xAF\x27\x1C")},
+	{ARCHIVE_FORMAT_RAR, []byte("Rar!\x1A\x07")},
+	// Any gzip is assumed to be a tarball, which fails to extract if it isn't.
+	{ARCHIVE_FORMAT_TAR_GZ, []byte("\x1F\x8B")},
+}
+
+// Works out the format of the archive at the given path from its contents, since mods are often named or renamed carelessly.
+// Returns [ErrUnsupportedArchive] if it isn't one of the supported formats.
+func DetectArchiveFormat(path string) (ArchiveFormat, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	for _, sig := range archiveSignatures {
+		if bytes.HasPrefix(header[:n], sig.signature) {
+			return sig.format, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedArchive, filepath.Base(path))
+}
+
+// Extracts the archive at the given path into dest, whichever supported format it is in. See [DetectArchiveFormat].
+func ExtractArchive(path, dest string) error {
+	return ExtractArchiveContext(context.Background(), path, dest, nil)
+}
+
+// Same as [ExtractArchive], but extraction stops as soon as ctx is cancelled, and progress is reported to the given func (if any).
+// Anything already extracted is left as is.
+//
+// Every format gets the same safeguards as [DoUnzipContext]. Entries are vetted before anything is extracted,
+// and rejected with an [ArchiveEntryError] if they could write outside of dest or are too large.
+func ExtractArchiveContext(ctx context.Context, path, dest string, progress ExtractProgressFunc) error {
+	format, err := DetectArchiveFormat(path)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ARCHIVE_FORMAT_ZIP:
+		return extractZip(ctx, path, dest, progress)
+	case ARCHIVE_FORMAT_7Z:
+		return extract7z(ctx, path, dest, progress)
+	case ARCHIVE_FORMAT_RAR:
+		return extractRar(ctx, path, dest, progress)
+	case ARCHIVE_FORMAT_TAR_GZ:
+		return extractTarGz(ctx, path, dest, progress)
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnsupportedArchive, format)
+}
+
+func extract7z(ctx context.Context, path, dest string, progress ExtractProgressFunc) error {
+	reader, err := sevenzip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 7z compresses files together, so there is no compressed size per entry.
+	entries := make([]archiveEntry, 0, len(reader.File))
+	for _, file := range reader.File {
+		entries = append(entries, archiveEntry{file.Name, file.Mode(), -1, clampSize(file.UncompressedSize)})
+	}
+
+	extractor, err := newEntryExtractor(ctx, path, dest, entries, progress)
+	if err != nil {
+		return err
+	}
+
+	// Going through them in order lets the reader decompress each stream once rather than starting over for every file.
+	for i, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s in archive: %v", file.Name, err)
+		}
+
+		err = extractor.extract(entries[i], rc)
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return extractor.finish()
+}
+
+func extractRar(ctx context.Context, path, dest string, progress ExtractProgressFunc) error {
+	// Headers are spread throughout a rar, so they have to be read in full once to be vetted, then again to be extracted.
+	entries := []archiveEntry{}
+	err := readRar(path, func(header *rardecode.FileHeader, _ io.Reader) error {
+		size := header.UnPackedSize
+		if header.UnKnownSize {
+			size = -1
+		}
+
+		entries = append(entries, archiveEntry{header.Name, header.Mode(), header.PackedSize, size})
+		if len(entries) > MAX_ARCHIVE_ENTRIES {
+			return checkArchiveEntries(entries, 0)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	extractor, err := newEntryExtractor(ctx, path, dest, entries, progress)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	err = readRar(path, func(header *rardecode.FileHeader, r io.Reader) error {
+		if i >= len(entries) || entries[i].name != header.Name {
+			return fmt.Errorf("archive changed while being extracted: %s", path)
+		}
+
+		i++
+		return extractor.extract(entries[i-1], r)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return extractor.finish()
+}
+
+// Calls fn for every entry in the rar at the given path, with a reader of its contents.
+func readRar(path string, fn func(header *rardecode.FileHeader, r io.Reader) error) error {
+	reader, err := rardecode.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(header, reader); err != nil {
+			return err
+		}
+	}
+}
+
+func extractTarGz(ctx context.Context, path, dest string, progress ExtractProgressFunc) error {
+	// Like a rar, the headers are spread throughout, so the whole thing is read once to vet them and again to extract.
+	entries := []archiveEntry{}
+	err := readTarGz(path, func(header *tar.Header, _ io.Reader) error {
+		entries = append(entries, tarEntry(header))
+		if len(entries) > MAX_ARCHIVE_ENTRIES {
+			return checkArchiveEntries(entries, 0)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	extractor, err := newEntryExtractor(ctx, path, dest, entries, progress)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	err = readTarGz(path, func(header *tar.Header, r io.Reader) error {
+		if i >= len(entries) || entries[i].name != header.Name {
+			return fmt.Errorf("archive changed while being extracted: %s", path)
+		}
+
+		i++
+		return extractor.extract(entries[i-1], r)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return extractor.finish()
+}
+
+func tarEntry(header *tar.Header) archiveEntry {
+	mode := header.FileInfo().Mode()
+
+	// Hard links can point anywhere just the same as symlinks.
+	if header.Typeflag == tar.TypeLink {
+		mode |= fs.ModeSymlink
+	}
+
+	return archiveEntry{header.Name, mode, -1, header.Size}
+}
+
+// Calls fn for every entry in the gzipped tarball at the given path, with a reader of its contents.
+// Extended headers used by tar itself are skipped, as they aren't files.
+func readTarGz(path string, fn func(header *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball: %v", err)
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		if err := fn(header, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// Writes entries of formats without a dedicated extractor to disk, holding each to the size it claims to be
+// and the archive as a whole to [MAX_ARCHIVE_TOTAL_SIZE].
+type entryExtractor struct {
+	ctx      context.Context
+	dest     string
+	progress ExtractProgressFunc
+
+	written      int64
+	total        int64
+	lastReported time.Time
+}
+
+// Vets the given entries and prepares to extract them into dest, returning an [ArchiveEntryError] if any are unsafe.
+func newEntryExtractor(ctx context.Context, path, dest string, entries []archiveEntry, progress ExtractProgressFunc) (*entryExtractor, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkArchiveEntries(entries, info.Size()); err != nil {
+		return nil, err
+	}
+
+	extractor := &entryExtractor{ctx: ctx, dest: dest, progress: progress}
+	for _, entry := range entries {
+		if entry.uncompressedSize < 0 {
+			extractor.total = -1
+			break
+		}
+
+		extractor.total += entry.uncompressedSize
+	}
+
+	return extractor, nil
+}
+
+func (e *entryExtractor) extract(entry archiveEntry, r io.Reader) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(e.dest, filepath.FromSlash(strings.ReplaceAll(entry.name, "\\", "/")))
+	if entry.mode.IsDir() {
+		return os.MkdirAll(path, 0o755)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	perm := fs.FileMode(0o644)
+	if entry.mode&0o111 != 0 {
+		perm = 0o755
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	limit := MAX_ARCHIVE_TOTAL_SIZE - e.written
+	if entry.uncompressedSize >= 0 {
+		limit = min(limit, entry.uncompressedSize)
+	}
+
+	// Reading one more than allowed is how we find out it has more to give than it should.
+	n, err := io.Copy(file, io.LimitReader(&contextReader{ctx: e.ctx, r: r, onRead: e.report}, limit+1))
+	if err != nil {
+		return err
+	}
+
+	if n > limit {
+		return &ArchiveEntryError{Entry: entry.name, Reason: "extracts to more than the allowed or declared size"}
+	}
+
+	return file.Close()
+}
+
+func (e *entryExtractor) report(n int) {
+	e.written += int64(n)
+	if e.progress != nil && time.Since(e.lastReported) >= EXTRACT_PROGRESS_INTERVAL {
+		e.lastReported = time.Now()
+		e.progress(e.written, e.total)
+	}
+}
+
+func (e *entryExtractor) finish() error {
+	if e.progress != nil {
+		e.progress(e.written, e.written)
+	}
+
+	return nil
+}
+
+// Stops a read part way through as soon as ctx is cancelled, since a single large entry can take a while.
+type contextReader struct {
+	ctx    context.Context
+	r      io.Reader
+	onRead func(n int)
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := cr.r.Read(p)
+	cr.onRead(n)
+
+	return n, err
+}
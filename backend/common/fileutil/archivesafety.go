@@ -0,0 +1,132 @@
+package fileutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// The most an archive can extract to in total. Entries are also stopped from writing more than they claim to.
+	MAX_ARCHIVE_TOTAL_SIZE = 8 << 30
+	MAX_ARCHIVE_ENTRIES    = 100_000
+	// The most an entry can be compressed by (uncompressed size / compressed size) before it is assumed to be an archive bomb.
+	MAX_ARCHIVE_COMPRESSION_RATIO = 200
+	// Entries smaller than this are never checked against the compression ratio,
+	// since small files of repetitive text can legitimately compress very well.
+	ARCHIVE_RATIO_MIN_SIZE = 1 << 20
+)
+
+// Matched by every [ArchiveEntryError], so callers can check for an unsafe archive with [errors.Is].
+var ErrUnsafeArchive = errors.New("archive is unsafe to extract")
+
+// Returned when an archive has an entry that could escape where it is being extracted to or is suspiciously large.
+type ArchiveEntryError struct {
+	// The name of the offending entry, as it appears in the archive.
+	Entry  string
+	Reason string
+}
+
+func (e *ArchiveEntryError) Error() string {
+	return fmt.Sprintf("invalid archive entry '%s': %s", e.Entry, e.Reason)
+}
+
+func (e *ArchiveEntryError) Is(target error) bool {
+	return target == ErrUnsafeArchive
+}
+
+// Only what's needed to vet and extract an entry, as each archive library has its own file type.
+type archiveEntry struct {
+	name string
+	mode fs.FileMode
+	// -1 if the format doesn't record it per entry, in which case the ratio is checked against the size of the whole archive.
+	compressedSize int64
+	// -1 if the format doesn't record it, in which case the entry is only held to what's left of the total size.
+	uncompressedSize int64
+}
+
+// Converts a size from a format that records them unsigned, so a huge one can't wrap around to look small.
+func clampSize(size uint64) int64 {
+	return int64(min(size, math.MaxInt64))
+}
+
+// Checks that the name of an archive entry is a relative path which stays inside wherever it is extracted to,
+// returning an [ArchiveEntryError] if not. Backslashes are treated as separators, since some zips made on Windows use them.
+func CheckArchiveEntryPath(name string) error {
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if strings.Trim(normalized, "/") == "" {
+		return &ArchiveEntryError{Entry: name, Reason: "empty path"}
+	}
+
+	if strings.HasPrefix(normalized, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		(len(normalized) >= 2 && normalized[1] == ':') {
+		return &ArchiveEntryError{Entry: name, Reason: "absolute paths are not allowed"}
+	}
+
+	for _, part := range strings.Split(normalized, "/") {
+		if part == ".." {
+			return &ArchiveEntryError{Entry: name, Reason: "path points outside of the destination"}
+		}
+	}
+
+	return nil
+}
+
+// Vets every entry before anything is extracted, returning an [ArchiveEntryError] for the first one that is unsafe.
+//
+// archiveSize is the size of the archive itself, which the overall ratio is checked against for formats
+// that don't record the compressed size of each entry.
+func checkArchiveEntries(entries []archiveEntry, archiveSize int64) error {
+	if len(entries) > MAX_ARCHIVE_ENTRIES {
+		return &ArchiveEntryError{
+			Entry:  entries[MAX_ARCHIVE_ENTRIES].name,
+			Reason: fmt.Sprintf("archive has more than %d entries", MAX_ARCHIVE_ENTRIES),
+		}
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if err := CheckArchiveEntryPath(entry.name); err != nil {
+			return err
+		}
+
+		// Even one pointing inside the destination could be followed by a later entry to write outside of it.
+		if entry.mode&fs.ModeSymlink != 0 {
+			return &ArchiveEntryError{Entry: entry.name, Reason: "links are not allowed"}
+		}
+
+		if entry.mode&(fs.ModeDevice|fs.ModeNamedPipe|fs.ModeSocket|fs.ModeIrregular) != 0 {
+			return &ArchiveEntryError{Entry: entry.name, Reason: "special files are not allowed"}
+		}
+
+		if entry.uncompressedSize <= 0 {
+			continue
+		}
+
+		total += entry.uncompressedSize
+		if total > MAX_ARCHIVE_TOTAL_SIZE {
+			return &ArchiveEntryError{
+				Entry:  entry.name,
+				Reason: fmt.Sprintf("archive extracts to more than %d bytes", int64(MAX_ARCHIVE_TOTAL_SIZE)),
+			}
+		}
+
+		// Without the compressed size of each entry, the best we can do is compare everything so far against the whole archive.
+		size, compressed := entry.uncompressedSize, entry.compressedSize
+		if compressed < 0 {
+			size, compressed = total, archiveSize
+		}
+
+		if size >= ARCHIVE_RATIO_MIN_SIZE && (compressed <= 0 || size/compressed > MAX_ARCHIVE_COMPRESSION_RATIO) {
+			return &ArchiveEntryError{
+				Entry:  entry.name,
+				Reason: fmt.Sprintf("compressed %d bytes down to %d, which is beyond the allowed ratio", size, compressed),
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package fileutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Files that mods are likely to write to at runtime. Hard linking these would let one mod's changes leak into every other copy.
+var dedupSkipExts = []string{".cfg", ".json", ".txt", ".ini", ".xml", ".yml", ".yaml", ".toml", ".log"}
+
+// Files that may still be growing, being downloads in progress (.part), archives yet to be extracted (.m8z, .zip)
+// and our own temporary links.
+var dedupPartialExts = []string{".part", ".m8z", ".zip", ".m8dedup"}
+
+var errChangedWhileHashing = errors.New("file changed while it was being hashed")
+
+type DedupReport struct {
+	FilesScanned int `json:"files_scanned"`
+	// How many files were replaced with a link to the store during this run.
+	FilesLinked int `json:"files_linked"`
+	// Files that couldn't be linked, usually because they are on a different drive to the store.
+	FilesSkipped int `json:"files_skipped"`
+	// Space freed by this run.
+	BytesSaved int64 `json:"bytes_saved"`
+	// Space saved by every file linked to the store so far, including previous runs.
+	TotalBytesSaved int64 `json:"total_bytes_saved"`
+}
+
+// Returns where a file with the given SHA-256 hash lives in a content-addressed store.
+func PathInStore(storeDir, hash string) string {
+	return filepath.Join(storeDir, hash[:2], hash)
+}
+
+// Replaces every file inside dirs that has identical contents to another with a hard link to a single copy
+// kept in the content-addressed store at storeDir. Paths inside dirs stay exactly as they were, they just share storage.
+//
+// Files that are likely to be written to (configs etc.) or still being written are left alone, as are hidden dirs
+// (staging dirs, the store and so on). Links are never followed.
+//
+// Nothing else should be writing to dirs while this runs, as a file that changes part way through can't be trusted.
+func DedupDirs(storeDir string, dirs []string) (*DedupReport, error) {
+	report := &DedupReport{}
+	var errBuilder strings.Builder
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+
+				return err
+			}
+
+			// Never descend into the store itself, or anything hidden such as staging dirs which may be mid-extraction.
+			if entry.IsDir() && path != dir && (filepath.Clean(path) == filepath.Clean(storeDir) || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+
+			ext := strings.ToLower(filepath.Ext(path))
+			if !entry.Type().IsRegular() || slices.Contains(dedupSkipExts, ext) || slices.Contains(dedupPartialExts, ext) {
+				return nil
+			}
+
+			report.FilesScanned++
+
+			linked, size, err := dedupFile(storeDir, path)
+			if err != nil {
+				report.FilesSkipped++
+				errBuilder.WriteString(fmt.Sprintf("%s: %v\n", path, err))
+				return nil
+			}
+
+			if linked {
+				report.FilesLinked++
+				report.BytesSaved += size
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+		}
+	}
+
+	var err error
+	report.TotalBytesSaved, err = StoreBytesSaved(storeDir)
+	if err != nil {
+		errBuilder.WriteString(err.Error() + "\n")
+	}
+
+	if errBuilder.Len() > 0 {
+		return report, fmt.Errorf("errors occurred deduplicating files:\n%s", errBuilder.String())
+	}
+
+	return report, nil
+}
+
+// Links the file at path to its copy in the store, adding it to the store first if it's the first of its kind.
+// Reports whether the file was replaced with a link, along with its size.
+func dedupFile(storeDir, path string) (bool, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return false, 0, err
+	}
+
+	hash, err := HashFile(path)
+	if err != nil {
+		return false, 0, err
+	}
+
+	stored := PathInStore(storeDir, hash)
+	storedInfo, err := os.Stat(stored)
+
+	// First time seeing this content, so this file becomes the stored copy.
+	if os.IsNotExist(err) {
+		if err := MkDirAll(filepath.Dir(stored)); err != nil {
+			return false, 0, err
+		}
+
+		if err := os.Link(path, stored); err != nil {
+			return false, 0, err
+		}
+
+		// Every identical file found later is linked to this one, so it has to still be what was hashed.
+		if storedHash, err := HashFile(stored); err != nil || storedHash != hash {
+			os.Remove(stored)
+			return false, 0, errors.Join(errChangedWhileHashing, err)
+		}
+
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	if os.SameFile(info, storedInfo) {
+		return false, 0, nil
+	}
+
+	// Link next to the original then rename over it, so the original is never missing if something fails.
+	tmp := path + ".m8dedup"
+	os.Remove(tmp)
+
+	if err := os.Link(stored, tmp); err != nil {
+		return false, 0, err
+	}
+
+	// Anything written to the original since it was hashed would be lost by replacing it.
+	if current, err := os.Stat(path); err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		os.Remove(tmp)
+		return false, 0, errors.Join(errChangedWhileHashing, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, 0, err
+	}
+
+	return true, info.Size(), nil
+}
+
+// Returns the space saved by the store, being the size of every stored file multiplied by how many extra places link to it.
+func StoreBytesSaved(storeDir string) (int64, error) {
+	var saved int64
+	err := walkStore(storeDir, func(path string, info fs.FileInfo, links uint64) error {
+		// One link is the store itself and one is the original file, anything beyond that is saved space.
+		if links > 2 {
+			saved += info.Size() * int64(links-2)
+		}
+
+		return nil
+	})
+
+	return saved, err
+}
+
+// Deletes every file in the store that nothing links to anymore, such as after the files linked to it were deleted.
+// Returns how many bytes were freed.
+func PruneStore(storeDir string) (int64, error) {
+	var freed int64
+	err := walkStore(storeDir, func(path string, info fs.FileInfo, links uint64) error {
+		if links > 1 {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+
+		freed += info.Size()
+		return nil
+	})
+
+	return freed, err
+}
+
+func walkStore(storeDir string, fn func(path string, info fs.FileInfo, links uint64) error) error {
+	err := filepath.WalkDir(storeDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		links, err := LinkCount(path)
+		if err != nil {
+			return err
+		}
+
+		return fn(path, info, links)
+	})
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
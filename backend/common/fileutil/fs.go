@@ -3,6 +3,7 @@ package fileutil
 import (
 	"bufio"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -73,6 +74,17 @@ func ExistsAtPath(absPath string) (bool, error) {
 	return err == nil, err
 }
 
+// Reports whether the item at the given path is itself a link (Symlink or Junction on Windows), without following it.
+func IsLink(path string) bool {
+	fi, err := os.Lstat(filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+
+	// Junctions are reported as irregular rather than symlinks on Windows.
+	return fi.Mode()&(os.ModeSymlink|os.ModeIrregular) != 0
+}
+
 // The same as os.ReadFile, but the path is cleaned automatically.
 func ReadFile(path string) ([]byte, error) {
 	return os.ReadFile(filepath.Clean(path))
@@ -176,3 +188,32 @@ func FindFirstSemverLine(path string) (*string, error) {
 
 	return nil, fmt.Errorf("no semver line found in file: %s", path)
 }
+
+// Reports whether anything inside a dir is currently opened by a running process. See [NewOpenFileChecker].
+type OpenFileChecker interface {
+	InUse(dir string) bool
+}
+
+// Returns the total size in bytes of every regular file inside the given dir. Links are not followed.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(filepath.Clean(path), func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,77 @@
+package fileutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Returns the hex encoded SHA-256 hash of everything read from r.
+func HashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns the hex encoded SHA-256 hash of the file at the given path.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return HashReader(file)
+}
+
+// Returns a hex encoded SHA-256 hash representing every regular file inside the dir at the given path.
+//
+// Each file contributes its slash-separated path (relative to the dir) and the hash of its contents,
+// in lexical order, so the result only changes if a file is added, removed, renamed or modified.
+// The dir itself is followed if it is a link, but links inside it are not.
+func HashDir(path string) (string, error) {
+	root, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	err = filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		fileHash, err := HashFile(p)
+		if err != nil {
+			return err
+		}
+
+		h.Write([]byte(filepath.ToSlash(relPath)))
+		h.Write([]byte{0})
+		h.Write([]byte(fileHash))
+		h.Write([]byte{'\n'})
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Finds open files by reading the fd and memory map tables of every process we have access to in /proc.
+// The kernel resolves links for us, so paths opened through a profile link show up as their real path in the mod cache.
+type procOpenFileChecker struct {
+	open []string
+}
+
+// Takes a snapshot of every file currently open by a running process, which can then be checked against.
+//
+// Only available where /proc exists. Elsewhere, an error is returned so callers can refuse to touch anything rather than guess.
+func NewOpenFileChecker() (OpenFileChecker, error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, errors.New("cannot detect open files. /proc is not available on this platform")
+	}
+
+	checker := &procOpenFileChecker{}
+	for _, proc := range procs {
+		if !proc.IsDir() || strings.Trim(proc.Name(), "0123456789") != "" {
+			continue
+		}
+
+		procDir := filepath.Join("/proc", proc.Name())
+
+		// Processes of other users can't be read, which is fine since a game we launched runs as us.
+		fds, _ := os.ReadDir(filepath.Join(procDir, "fd"))
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(procDir, "fd", fd.Name())); err == nil && filepath.IsAbs(target) {
+				checker.open = append(checker.open, target)
+			}
+		}
+
+		// Assemblies are often memory mapped and closed straight after, so they only show up here.
+		if maps, err := os.ReadFile(filepath.Join(procDir, "maps")); err == nil {
+			for _, line := range strings.Split(string(maps), "\n") {
+				if idx := strings.Index(line, " /"); idx != -1 {
+					checker.open = append(checker.open, strings.TrimSuffix(line[idx+1:], " (deleted)"))
+				}
+			}
+		}
+	}
+
+	return checker, nil
+}
+
+func (checker *procOpenFileChecker) InUse(dir string) bool {
+	for _, path := range checker.open {
+		if IsWithinDir(dir, path) {
+			return true
+		}
+	}
+
+	return false
+}
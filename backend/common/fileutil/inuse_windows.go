@@ -0,0 +1,54 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows refuses to open a file without sharing while anything else has it open (loaded assemblies included),
+// so we can find out by trying to. Nothing is moved or renamed, so links into the dir keep working throughout.
+type exclusiveOpenFileChecker struct{}
+
+func NewOpenFileChecker() (OpenFileChecker, error) {
+	return exclusiveOpenFileChecker{}, nil
+}
+
+func (exclusiveOpenFileChecker) InUse(dir string) bool {
+	inUse := false
+
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		if isFileOpen(path) {
+			inUse = true
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+
+	return inUse
+}
+
+func isFileOpen(path string) bool {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+
+	// A share mode of 0 asks for the file all to ourselves.
+	handle, err := windows.CreateFile(name, windows.GENERIC_READ, 0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+	}
+
+	windows.CloseHandle(handle)
+	return false
+}
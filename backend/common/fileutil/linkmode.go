@@ -0,0 +1,228 @@
+package fileutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// How a dir is mirrored somewhere else. See [LinkDirWithMode].
+type LinkMode string
+
+const (
+	// Pick the best mode the file system supports. See [ProbeLinkMode].
+	LINK_MODE_AUTO LinkMode = "auto"
+	// A single Symlink (Junction on Windows) to the source dir. Needs the file system to support links.
+	LINK_MODE_SYMLINK LinkMode = "symlink"
+	// A real dir tree where every file is a hard link to the same file in the source. Needs both to be on the same drive.
+	LINK_MODE_HARDLINK LinkMode = "hardlink"
+	// A full copy of the source. Always works, but takes up the space of the source again.
+	LINK_MODE_COPY LinkMode = "copy"
+)
+
+// Written inside dirs materialized by hardlinking or copying, holding the path of the source they mirror.
+// This is how they can be told apart from dirs that were put there by hand.
+const LINK_MARKER_NAME = ".m8link"
+
+var (
+	linkModeMutex     sync.RWMutex
+	preferredLinkMode = LINK_MODE_AUTO
+)
+
+// Sets the link mode used when nothing more specific has been chosen. Usually called when the app settings are applied.
+func SetPreferredLinkMode(mode LinkMode) {
+	if mode == "" {
+		mode = LINK_MODE_AUTO
+	}
+
+	linkModeMutex.Lock()
+	defer linkModeMutex.Unlock()
+
+	preferredLinkMode = mode
+}
+
+func PreferredLinkMode() LinkMode {
+	linkModeMutex.RLock()
+	defer linkModeMutex.RUnlock()
+
+	return preferredLinkMode
+}
+
+// Finds the best link mode for mirroring dirs from sourceDir into targetDir by trying each in turn,
+// from symlinks to hard links, falling back to copying if neither work.
+//
+// Both dirs are created if they don't exist.
+func ProbeLinkMode(targetDir, sourceDir string) LinkMode {
+	if MkDirAll(targetDir) != nil || MkDirAll(sourceDir) != nil {
+		return LINK_MODE_COPY
+	}
+
+	probeSource := filepath.Join(sourceDir, ".m8probe-src")
+	probeTarget := filepath.Join(targetDir, ".m8probe-link")
+
+	defer os.RemoveAll(probeSource)
+	defer os.Remove(probeTarget)
+
+	os.RemoveAll(probeSource)
+	os.Remove(probeTarget)
+
+	if MkDir(probeSource) != nil {
+		return LINK_MODE_COPY
+	}
+
+	if err := CreateSymlinkOrJunction(probeTarget, probeSource); err == nil {
+		if info, err := os.Stat(probeTarget); err == nil && info.IsDir() {
+			return LINK_MODE_SYMLINK
+		}
+	}
+
+	os.Remove(probeTarget)
+
+	probeFile := filepath.Join(probeSource, "probe")
+	if WriteFile(probeFile, []byte{}) == nil && os.Link(probeFile, probeTarget) == nil {
+		return LINK_MODE_HARDLINK
+	}
+
+	return LINK_MODE_COPY
+}
+
+// Makes `target` mirror the contents of the dir `source` using the given mode. See [LinkMode].
+//
+// Symlinks are created with [LinkDir]. The other modes create a real dir at target, along with a marker file
+// recording the source, so it can later be recognised by [IsDirLink] and removed with [UnlinkDir].
+func LinkDirWithMode(target, source string, mode LinkMode) error {
+	switch mode {
+	case LINK_MODE_SYMLINK:
+		return LinkDir(target, source)
+	case LINK_MODE_HARDLINK, LINK_MODE_COPY:
+	default:
+		return fmt.Errorf("unknown link mode: %s", mode)
+	}
+
+	sfi, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("error validating source path. dir may not exist:\n%v", err)
+	}
+
+	if !sfi.IsDir() {
+		return fmt.Errorf("invalid source path. must be a dir")
+	}
+
+	source = filepath.Clean(source)
+	err = filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(target, rel)
+
+		switch {
+		case entry.IsDir():
+			return MkDirAll(dest)
+		case !entry.Type().IsRegular():
+			return CopyLink(path, dest)
+		case mode == LINK_MODE_HARDLINK:
+			return os.Link(path, dest)
+		default:
+			return CopyFile(path, dest)
+		}
+	})
+
+	if err != nil {
+		// Don't leave a half materialized dir that would be mistaken for a complete one.
+		os.RemoveAll(target)
+		return err
+	}
+
+	return WriteFile(filepath.Join(target, LINK_MARKER_NAME), []byte(source))
+}
+
+// Reports whether the dir at the given path was created by [LinkDirWithMode] in any mode.
+func IsDirLink(path string) bool {
+	if IsLink(path) {
+		return true
+	}
+
+	exists, _ := ExistsAtPath(filepath.Join(path, LINK_MARKER_NAME))
+	return exists
+}
+
+// Returns the source dir that the dir at the given path mirrors, regardless of which mode it was linked with.
+func ReadDirLink(path string) (string, error) {
+	if IsLink(path) {
+		return os.Readlink(path)
+	}
+
+	contents, err := ReadFile(filepath.Join(path, LINK_MARKER_NAME))
+	if err != nil {
+		return "", fmt.Errorf("%s is not a link", path)
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// Removes a dir created by [LinkDirWithMode]. The source dir is never touched.
+// Anything else at the path is refused, so a dir that was put there by hand can't be deleted by mistake.
+func UnlinkDir(path string) error {
+	if IsLink(path) {
+		return os.Remove(path)
+	}
+
+	if exists, err := ExistsAtPath(path); !exists {
+		if err == nil {
+			err = &fs.PathError{Op: "unlink", Path: path, Err: fs.ErrNotExist}
+		}
+
+		return err
+	}
+
+	if !IsDirLink(path) {
+		return fmt.Errorf("refusing to remove %s. it is not a link", path)
+	}
+
+	return os.RemoveAll(path)
+}
+
+// Reports which mode the dir at the given path was linked with, or an empty string if it isn't a link.
+func DirLinkMode(path string) LinkMode {
+	if IsLink(path) {
+		return LINK_MODE_SYMLINK
+	}
+
+	if !IsDirLink(path) {
+		return ""
+	}
+
+	// Hard linked files share their storage with the source, copies don't.
+	source, err := ReadDirLink(path)
+	if err != nil {
+		return LINK_MODE_COPY
+	}
+
+	var mode LinkMode = LINK_MODE_COPY
+	filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() || entry.Name() == LINK_MARKER_NAME {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(path, p)
+		srcInfo, srcErr := os.Stat(filepath.Join(source, rel))
+		info, infoErr := entry.Info()
+
+		if srcErr == nil && infoErr == nil && os.SameFile(srcInfo, info) {
+			mode = LINK_MODE_HARDLINK
+		}
+
+		return filepath.SkipAll
+	})
+
+	return mode
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns how many hard links point to the file at the given path, including itself.
+func LinkCount(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(file.Fd()), &info); err != nil {
+		return 0, err
+	}
+
+	return uint64(info.NumberOfLinks), nil
+}
@@ -0,0 +1,200 @@
+package fileutil
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Reports whether path is dir itself or somewhere inside of it.
+func IsWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// Moves the dir at src to dest, which must not exist yet (or be an empty dir).
+//
+// A rename is tried first, falling back to copying then removing src when that isn't possible, like when moving to another drive.
+// Links inside src are recreated at dest pointing to the same place, rather than having their contents copied.
+func MoveDir(src, dest string) error {
+	src, dest = filepath.Clean(src), filepath.Clean(dest)
+
+	if IsWithinDir(src, dest) {
+		return fmt.Errorf("cannot move %s into itself", src)
+	}
+
+	if entries, err := os.ReadDir(dest); err == nil {
+		if len(entries) > 0 {
+			return fmt.Errorf("cannot move to %s. dir is not empty", dest)
+		}
+
+		// Remove it so a plain rename can take its place.
+		if err := os.Remove(dest); err != nil {
+			return err
+		}
+	}
+
+	if err := MkDirAll(filepath.Dir(dest)); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	if err := CopyDir(src, dest); err != nil {
+		// Don't leave a half copied dir behind, src is still intact.
+		os.RemoveAll(dest)
+		return fmt.Errorf("failed to copy %s to %s:\n%v", src, dest, err)
+	}
+
+	return os.RemoveAll(src)
+}
+
+// Recursively copies the contents of src into dest, creating dest if needed.
+// Links are recreated pointing to the same place as the originals instead of being followed.
+func CopyDir(src, dest string) error {
+	src = filepath.Clean(src)
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, rel)
+
+		if IsLink(path) {
+			return CopyLink(path, target)
+		}
+
+		if entry.IsDir() {
+			return MkDirAll(target)
+		}
+
+		return CopyFile(path, target)
+	})
+}
+
+// Creates a link at dest that points to the same place as the link at src.
+func CopyLink(src, dest string) error {
+	linkSource, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	// Dir links need to be a junction on Windows.
+	if info, err := os.Stat(src); err == nil && info.IsDir() {
+		return CreateSymlinkOrJunction(dest, linkSource)
+	}
+
+	return os.Symlink(linkSource, dest)
+}
+
+// Copies the contents and permissions of the file at src to a new file at dest.
+func CopyFile(src, dest string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// Finds every link under root pointing somewhere inside oldDir, and replaces it with a link to the same relative place inside newDir.
+//
+// Returns how many links were updated. Errors are accumulated so one bad link doesn't stop the rest from being updated.
+func RetargetLinks(root, oldDir, newDir string) (int, error) {
+	count := 0
+	var errBuilder strings.Builder
+
+	err := filepath.WalkDir(filepath.Clean(root), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		// WalkDir doesn't follow links, so anything below a link won't be visited.
+		if !IsDirLink(path) {
+			return nil
+		}
+
+		// Hard linked and copied dirs are real dirs, so they must be skipped by hand.
+		var skip error
+		if entry.IsDir() {
+			skip = filepath.SkipDir
+		}
+
+		linkSource, err := ReadDirLink(path)
+		if err != nil || !IsWithinDir(oldDir, linkSource) {
+			return skip
+		}
+
+		rel, _ := filepath.Rel(filepath.Clean(oldDir), filepath.Clean(linkSource))
+		newSource := filepath.Join(newDir, rel)
+
+		// Their contents don't depend on where the source lives, only the recorded source needs updating.
+		if !IsLink(path) {
+			if err := WriteFile(filepath.Join(path, LINK_MARKER_NAME), []byte(newSource)); err != nil {
+				errBuilder.WriteString(err.Error() + "\n")
+				return skip
+			}
+
+			count++
+			return skip
+		}
+
+		if err := os.Remove(path); err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+			return nil
+		}
+
+		if err := LinkDir(path, newSource); err != nil {
+			errBuilder.WriteString(fmt.Sprintf("failed to relink %s: %v\n", path, err))
+			return nil
+		}
+
+		count++
+		return nil
+	})
+
+	if err != nil {
+		errBuilder.WriteString(err.Error() + "\n")
+	}
+
+	if errBuilder.Len() > 0 {
+		return count, fmt.Errorf("errors occurred updating links:\n%s", errBuilder.String())
+	}
+
+	return count, nil
+}
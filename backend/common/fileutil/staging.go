@@ -0,0 +1,64 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Hidden dir where things are put together before being moved into place. See [NewStagingDir].
+const STAGING_DIR_NAME = ".staging"
+
+// Creates a new empty dir where whatever should end up at dest can be put together first.
+//
+// It lives in a hidden dir next to dest, so it is on the same file system and [CommitStagingDir] can move it into place
+// with a single rename. That way dest either doesn't exist or is complete, never anything in between.
+func NewStagingDir(dest string) (string, error) {
+	dest = filepath.Clean(dest)
+	root := filepath.Join(filepath.Dir(dest), STAGING_DIR_NAME)
+
+	if err := MkDirAll(root); err != nil {
+		return "", err
+	}
+
+	return os.MkdirTemp(root, filepath.Base(dest)+"-*")
+}
+
+// Moves a dir made by [NewStagingDir] into place at dest, failing if anything already exists there.
+func CommitStagingDir(stagingPath, dest string) error {
+	if exists, _ := ExistsAtPath(dest); exists {
+		return fmt.Errorf("cannot move staged dir into place. %s already exists", dest)
+	}
+
+	return os.Rename(stagingPath, dest)
+}
+
+// Deletes the staging dir inside each of the given dirs, along with anything left in it by whatever was interrupted.
+// Must only be called when nothing is being staged, such as on startup.
+//
+// Returns how many staging dirs were deleted.
+func CleanupStagingDirs(dirs []string) (int, error) {
+	count := 0
+	var errBuilder strings.Builder
+
+	for _, dir := range dirs {
+		root := filepath.Join(dir, STAGING_DIR_NAME)
+		if exists, _ := ExistsAtPath(root); !exists {
+			continue
+		}
+
+		if err := os.RemoveAll(root); err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+			continue
+		}
+
+		count++
+	}
+
+	if errBuilder.Len() > 0 {
+		return count, fmt.Errorf("errors occurred cleaning up staging dirs:\n%s", errBuilder.String())
+	}
+
+	return count, nil
+}
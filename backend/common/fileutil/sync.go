@@ -0,0 +1,128 @@
+package fileutil
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Makes dest an exact mirror of src, creating it if needed. Only files that are new or have changed
+// (going by size and modification time) are copied, and anything in dest that isn't in src is deleted.
+//
+// Names in keep are left alone in the root of dest even though src doesn't have them, such as a marker the caller put there.
+//
+// Returns how many files were copied or deleted, so callers can tell whether anything actually changed.
+func SyncDir(src, dest string, keep ...string) (int, error) {
+	src = filepath.Clean(src)
+	dest = filepath.Clean(dest)
+
+	if err := MkDirAll(dest); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	inSrc := make(map[string]bool)
+
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		inSrc[rel] = true
+		target := filepath.Join(dest, rel)
+
+		if IsLink(path) {
+			linkSource, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			// Links can't have their times kept like files, so what they point at is compared instead.
+			if existing, err := os.Readlink(target); err == nil && existing == linkSource {
+				return nil
+			}
+
+			os.RemoveAll(target)
+			changed++
+
+			return CopyLink(path, target)
+		}
+
+		if entry.IsDir() {
+			// Whatever is there could be a file that has since become a dir.
+			if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+				os.Remove(target)
+			}
+
+			return MkDirAll(target)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if existing, err := os.Lstat(target); err == nil {
+			if existing.Mode().IsRegular() && existing.Size() == info.Size() && existing.ModTime().Equal(info.ModTime()) {
+				return nil
+			}
+
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+
+		if err := CopyFile(path, target); err != nil {
+			return err
+		}
+
+		changed++
+
+		// Keeping the time of the original is how we know it's unchanged next time.
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+
+	if err != nil {
+		return changed, err
+	}
+
+	stale := []string{}
+	err = filepath.WalkDir(dest, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dest, path)
+		if err != nil || rel == "." || inSrc[rel] || slices.Contains(keep, rel) {
+			return err
+		}
+
+		stale = append(stale, path)
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return changed, err
+	}
+
+	// Stale dirs were skipped over above, so none of these are inside another.
+	for _, path := range stale {
+		if err := os.RemoveAll(path); err != nil {
+			return changed, err
+		}
+
+		changed++
+	}
+
+	return changed, nil
+}
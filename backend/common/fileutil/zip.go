@@ -7,12 +7,25 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/saracen/fastzip"
 )
 
 // Opens a zip file and extracts its contents via a background operation.
 func DoUnzip(path, dest string) error {
+	return DoUnzipContext(context.Background(), path, dest)
+}
+
+// Same as [DoUnzip], but extraction stops as soon as ctx is cancelled. Anything already extracted is left as is.
+//
+// Every entry is vetted before anything is extracted, so an archive that could write outside of dest
+// or is too large is rejected with an [ArchiveEntryError] without extracting any of it.
+func DoUnzipContext(ctx context.Context, path, dest string) error {
+	return extractZip(ctx, path, dest, nil)
+}
+
+func extractZip(ctx context.Context, path, dest string, progress ExtractProgressFunc) error {
 	// Initialize an extractor
 	e, err := fastzip.NewExtractor(path, dest)
 	if err != nil {
@@ -20,11 +33,49 @@ func DoUnzip(path, dest string) error {
 	}
 	defer e.Close()
 
-	// Use extractor to extract the archive. (As a background operation)
-	if err = e.Extract(context.Background()); err != nil {
+	files := e.Files()
+	entries := make([]archiveEntry, 0, len(files))
+
+	var total int64
+	for _, file := range files {
+		entry := archiveEntry{file.Name, file.Mode(), clampSize(file.CompressedSize64), clampSize(file.UncompressedSize64)}
+		entries = append(entries, entry)
+		total += entry.uncompressedSize
+	}
+
+	if err := checkArchiveEntries(entries, 0); err != nil {
 		return err
 	}
 
+	// The extractor has no way to report progress itself, so poll it until it's done.
+	if progress != nil {
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			ticker := time.NewTicker(EXTRACT_PROGRESS_INTERVAL)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					written, _ := e.Written()
+					progress(written, total)
+				}
+			}
+		}()
+	}
+
+	if err = e.Extract(ctx); err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(total, total)
+	}
+
 	return e.Close()
 }
 
@@ -32,7 +83,12 @@ func DoUnzip(path, dest string) error {
 //
 // However, if delete is true, this func will delete the original zip after extraction, regardless of whether it succeeded.
 func Unzip(path, dest string, delete bool) error {
-	err := DoUnzip(path, dest)
+	return UnzipContext(context.Background(), path, dest, delete)
+}
+
+// Same as [Unzip], but extraction stops as soon as ctx is cancelled. See [DoUnzipContext].
+func UnzipContext(ctx context.Context, path, dest string, delete bool) error {
+	err := DoUnzipContext(ctx, path, dest)
 	if !delete {
 		return err
 	}
@@ -53,6 +109,8 @@ func Unzip(path, dest string, delete bool) error {
 // the file name and the value represents the file contents as a byte slice.
 //
 // Note that a byte slice (file) in the map may be nil if an error occurred or the file is empty.
+//
+// The zip is vetted the same way as [DoUnzipContext] before anything is read.
 func GetFilesInZip(data []byte) (map[string][]byte, error) {
 	// Create a zip reader
 	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
@@ -60,6 +118,15 @@ func GetFilesInZip(data []byte) (map[string][]byte, error) {
 		return nil, fmt.Errorf("failed to create zip reader: %w", err)
 	}
 
+	entries := make([]archiveEntry, 0, len(reader.File))
+	for _, f := range reader.File {
+		entries = append(entries, archiveEntry{f.Name, f.Mode(), clampSize(f.CompressedSize64), clampSize(f.UncompressedSize64)})
+	}
+
+	if err := checkArchiveEntries(entries, int64(len(data))); err != nil {
+		return nil, err
+	}
+
 	files := make(map[string][]byte)
 	for _, f := range reader.File {
 		rc, err := f.Open()
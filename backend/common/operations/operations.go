@@ -0,0 +1,222 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the events emitted as operations start, report progress and finish. See [SetHandler].
+const (
+	STARTED_EVENT  = "operation:started"
+	UPDATED_EVENT  = "operation:updated"
+	FINISHED_EVENT = "operation:finished"
+)
+
+var ErrNotFound = errors.New("no operation with that id is running")
+
+// Returned by maintenance that moves or rewrites files other operations may be using, if any are running.
+var ErrBusy = errors.New("cannot run while other operations are in progress")
+
+type OperationKind string
+
+const (
+	OP_INSTALL      OperationKind = "install"
+	OP_IMPORT       OperationKind = "import"
+	OP_REPAIR       OperationKind = "repair"
+	OP_RESTORE      OperationKind = "restore"
+	OP_REPAIR_CACHE OperationKind = "repair_cache"
+	OP_DEV_WATCH    OperationKind = "dev_watch"
+)
+
+// A long running task (usually downloading and installing mods) that can be cancelled while it runs.
+type Operation struct {
+	ID   string        `json:"id"`
+	Kind OperationKind `json:"kind"`
+	// What the operation is working on, such as the full name of a package or the name of a profile.
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	// What the operation last reported doing, for those that keep running until cancelled. See [Operation.Update].
+	Status string `json:"status,omitempty"`
+	// Only set once finished.
+	Cancelled bool   `json:"cancelled"`
+	Error     string `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+	signal chan struct{}
+}
+
+// Receives every operation as it starts, whenever it reports an update and again once it finishes.
+type Handler func(event string, op Operation)
+
+var (
+	opsMutex sync.Mutex
+	ops      = map[string]*Operation{}
+	handler  Handler
+	nextID   atomic.Uint64
+)
+
+// Sets the handler every operation event is passed to. The app forwards them to the frontend so it knows what it can cancel. nil stops reporting.
+func SetHandler(h Handler) {
+	opsMutex.Lock()
+	defer opsMutex.Unlock()
+
+	handler = h
+}
+
+// Registers a new operation and returns a context that is cancelled if the operation is, along with the operation itself.
+// [Operation.Finish] must be called once the operation is done, whether it succeeded or not.
+func Start(kind OperationKind, name string) (context.Context, *Operation) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	op := &Operation{
+		ID:        fmt.Sprintf("%s-%d", kind, nextID.Add(1)),
+		Kind:      kind,
+		Name:      name,
+		StartedAt: time.Now().UTC(),
+		cancel:    cancel,
+		signal:    make(chan struct{}, 1),
+	}
+
+	opsMutex.Lock()
+	ops[op.ID] = op
+	h := handler
+	opsMutex.Unlock()
+
+	if h != nil {
+		h(STARTED_EVENT, *op)
+	}
+
+	return ctx, op
+}
+
+// Unregisters the operation, recording whether it failed or was cancelled.
+// Takes a pointer to the error so it can be deferred with a named return value.
+func (op *Operation) Finish(errPtr *error) {
+	var err error
+	if errPtr != nil {
+		err = *errPtr
+	}
+
+	opsMutex.Lock()
+	delete(ops, op.ID)
+	h := handler
+	opsMutex.Unlock()
+
+	if err != nil {
+		op.Error = err.Error()
+		op.Cancelled = errors.Is(err, context.Canceled)
+	}
+
+	op.cancel()
+
+	if h != nil {
+		h(FINISHED_EVENT, *op)
+	}
+}
+
+// Records what the operation is currently doing and passes it on to the handler.
+func (op *Operation) Update(status string) {
+	opsMutex.Lock()
+	op.Status = status
+	snapshot := *op
+	h := handler
+	opsMutex.Unlock()
+
+	if h != nil {
+		h(UPDATED_EVENT, snapshot)
+	}
+}
+
+// Receives whenever [Signal] is called with the ID of this operation. Signals sent before the last one was received are merged into it.
+func (op *Operation) Signals() <-chan struct{} {
+	return op.signal
+}
+
+// Nudges the running operation with the given ID, for those that repeat their work on request (such as a dev watch syncing).
+// Operations that don't listen for signals ignore it.
+func Signal(id string) error {
+	opsMutex.Lock()
+	op, ok := ops[id]
+	opsMutex.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	select {
+	case op.signal <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Cancels the running operation with the given ID. Whatever it was doing is stopped and rolled back where possible.
+func Cancel(id string) error {
+	opsMutex.Lock()
+	op, ok := ops[id]
+	opsMutex.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	op.cancel()
+	return nil
+}
+
+// Cancels everything that is still running. Called on shutdown so nothing is left half done.
+func CancelAll() {
+	opsMutex.Lock()
+	defer opsMutex.Unlock()
+
+	for _, op := range ops {
+		op.cancel()
+	}
+}
+
+// Returns a copy of each running operation, sorted by when it started.
+func List() []Operation {
+	opsMutex.Lock()
+	defer opsMutex.Unlock()
+
+	list := make([]Operation, 0, len(ops))
+	for _, op := range ops {
+		list = append(list, *op)
+	}
+
+	slices.SortFunc(list, func(a, b Operation) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return list
+}
+
+// Lets the frontend see and cancel running operations.
+type OperationManager struct{}
+
+func NewOperationManager() *OperationManager {
+	return &OperationManager{}
+}
+
+func (om *OperationManager) ListOperations() []Operation {
+	return List()
+}
+
+func (om *OperationManager) CancelOperation(id string) error {
+	return Cancel(id)
+}
+
+func (om *OperationManager) CancelAllOperations() {
+	CancelAll()
+}
@@ -10,9 +10,16 @@ func ConfigDir() string {
 	return filepath.Join(dir, "modm8")
 }
 
-// Uses the users config dir and returns a path to the mod cache.
+// Returns the path to the global mod cache. This is inside the users config dir unless it has been moved elsewhere.
 func ModCacheDir() string {
-	return filepath.Join(ConfigDir(), "ModCache")
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	if storageOverrides.ModCacheDir != "" {
+		return storageOverrides.ModCacheDir
+	}
+
+	return DefaultModCacheDir()
 }
 
 func NexusKeyPath() string {
@@ -0,0 +1,102 @@
+package paths
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Where a single game stores its profiles and mods, taking priority over the global [StorageOverrides].
+type GameStorageOverrides struct {
+	// The title of the game with its original casing, since the key it is stored under is lowercased.
+	Title string
+	// Holds the Profiles and Snapshots dirs of the game.
+	GameDir     string
+	ModCacheDir string
+}
+
+// Custom locations for profiles and the mod cache. Empty paths fall back to the defaults inside [ConfigDir].
+type StorageOverrides struct {
+	// Holds a dir per game, which in turn holds its Profiles and Snapshots dirs.
+	GamesDir    string
+	ModCacheDir string
+	// Keyed by game title. Lookups ignore case since the settings file lowercases its keys.
+	Games map[string]GameStorageOverrides
+}
+
+var (
+	storageMutex     sync.RWMutex
+	storageOverrides StorageOverrides
+)
+
+// Replaces the current storage overrides. Usually called when the app settings are applied.
+func SetStorageOverrides(overrides StorageOverrides) {
+	games := make(map[string]GameStorageOverrides, len(overrides.Games))
+	for title, game := range overrides.Games {
+		games[strings.ToLower(title)] = game
+	}
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	overrides.Games = games
+	storageOverrides = overrides
+}
+
+func GetStorageOverrides() StorageOverrides {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	return storageOverrides
+}
+
+func gameOverrides(gameTitle string) GameStorageOverrides {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	return storageOverrides.Games[strings.ToLower(gameTitle)]
+}
+
+func DefaultGamesDir() string {
+	return filepath.Join(ConfigDir(), "Games")
+}
+
+func DefaultModCacheDir() string {
+	return filepath.Join(ConfigDir(), "ModCache")
+}
+
+// Returns the dir holding a dir for every game, unless the game has its own location. See [GameDir].
+func GamesDir() string {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	if storageOverrides.GamesDir != "" {
+		return storageOverrides.GamesDir
+	}
+
+	return DefaultGamesDir()
+}
+
+// Returns the dir holding the Profiles and Snapshots dirs of the given game.
+func GameDir(gameTitle string) string {
+	if dir := gameOverrides(gameTitle).GameDir; dir != "" {
+		return dir
+	}
+
+	return filepath.Join(GamesDir(), gameTitle)
+}
+
+// Returns the mod cache dir of the given game. Unless the game has its own location, this is a dir
+// named after the game inside the global mod cache, so that identically named mods from different games can't collide.
+func GameModCacheDir(gameTitle string) string {
+	if dir := gameOverrides(gameTitle).ModCacheDir; dir != "" {
+		return dir
+	}
+
+	return DefaultGameModCacheDir(gameTitle)
+}
+
+// Returns where the mod cache of the given game is when it doesn't have its own location.
+func DefaultGameModCacheDir(gameTitle string) string {
+	return filepath.Join(ModCacheDir(), gameTitle)
+}
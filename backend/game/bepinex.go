@@ -40,6 +40,11 @@ func ParseBepinexConfig(path string) (*BepinexConfig, error) {
 		return nil, err
 	}
 
+	return ParseBepinexConfigData(contents), nil
+}
+
+// Same as [ParseBepinexConfig], but parses config contents which have already been read into memory.
+func ParseBepinexConfigData(contents []byte) *BepinexConfig {
 	entries := make(map[string]BepinexConfigEntry)
 
 	// Distinct key to avoid conflicting with a possible section.
@@ -128,7 +133,7 @@ func ParseBepinexConfig(path string) (*BepinexConfig, error) {
 	return &BepinexConfig{
 		RootComments: rootComments,
 		Entries:      entries,
-	}, nil
+	}
 }
 
 func BepinexInstalled(absPath string) (bool, []string) {
@@ -0,0 +1,406 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
+	runners "modm8/backend/launchers"
+	"modm8/backend/loaders"
+	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// How long the build dir has to go without changes before it is synced, since a single build writes many files.
+const DEV_WATCH_DEBOUNCE = 500 * time.Millisecond
+
+// Left in a dir synced by a dev watch, so a later watch knows it can safely sync over it.
+// Anything else already at the watch's path is refused, as it could be a mod the user installed.
+const DEV_WATCH_MARKER_NAME = ".m8dev"
+
+type DevWatchMode string
+
+const (
+	// Copies the build output into the profile on every change, so the game never holds onto files the next build needs to overwrite.
+	DEV_WATCH_SYNC DevWatchMode = "sync"
+	// Links the build output straight into the profile, so nothing needs copying but the build dir must not be locked by the game.
+	DEV_WATCH_LINK DevWatchMode = "link"
+)
+
+type DevWatchOptions struct {
+	Loader      loaders.ModLoaderType `json:"loader"`
+	GameTitle   string                `json:"game_title"`
+	ProfileName string                `json:"profile_name"`
+	// The dir the mod is built into.
+	BuildDir string `json:"build_dir"`
+	// What the mod's dir in the profile is called. Defaults to "dev-" followed by the name of the build dir.
+	Name string       `json:"name"`
+	Mode DevWatchMode `json:"mode"`
+	// Restarts the game after every sync. Only supported by the direct launcher, as a game started any other way can't be stopped.
+	Restart bool         `json:"restart"`
+	Target  LaunchTarget `json:"target"`
+}
+
+// The state of a running dev watch. Registered as an [operations.OP_DEV_WATCH] operation named after
+// the path it syncs into, which reports the outcome of every sync as its status.
+type devWatch struct {
+	opts DevWatchOptions
+	// Where the build output ends up inside the profile.
+	path    string
+	op      *operations.Operation
+	watcher *fsnotify.Watcher
+	// The game we last started, if restarting. Only touched by the watch's own goroutine.
+	game *gocmd.Cmd
+}
+
+// Held while starting a watch, so two can't claim the same path at once.
+var devWatchMutex sync.Mutex
+
+// Starts watching the build dir of a mod, bringing it into the loader's mod link path of the profile straight away
+// and again every time the build dir changes. See [DevWatchMode] for how it is brought in.
+//
+// The mod isn't added to the profile's manifest, so it never ends up in exports or lockfiles.
+// A sync can also be triggered by hand with [TriggerDevWatch], such as to restart the game without rebuilding.
+// The watch runs until cancelled with [StopDevWatch] or [operations.Cancel].
+func StartDevWatch(opts DevWatchOptions) (operations.Operation, error) {
+	// The build dir is compared against link sources and stored in the marker, so it can't depend on our working dir.
+	buildDir, err := filepath.Abs(opts.BuildDir)
+	if err != nil {
+		return operations.Operation{}, err
+	}
+
+	opts.BuildDir = buildDir
+
+	info, err := os.Stat(opts.BuildDir)
+	if err != nil {
+		return operations.Operation{}, fmt.Errorf("cannot watch build dir:\n%v", err)
+	}
+	if !info.IsDir() {
+		return operations.Operation{}, fmt.Errorf("cannot watch %s. build output must be a dir", opts.BuildDir)
+	}
+
+	if exists, _ := profile.ProfileExists(opts.GameTitle, opts.ProfileName); !exists {
+		return operations.Operation{}, fmt.Errorf("profile '%s' does not exist", opts.ProfileName)
+	}
+
+	if opts.Mode == "" {
+		opts.Mode = DEV_WATCH_SYNC
+	}
+	if opts.Mode != DEV_WATCH_SYNC && opts.Mode != DEV_WATCH_LINK {
+		return operations.Operation{}, fmt.Errorf("unknown dev watch mode: %s", opts.Mode)
+	}
+
+	if opts.Name == "" {
+		opts.Name = "dev-" + filepath.Base(opts.BuildDir)
+	}
+
+	// The name is joined onto the mod link path, so it must not be able to point anywhere else.
+	if opts.Name == "." || opts.Name == ".." || strings.ContainsAny(opts.Name, `/\`) {
+		return operations.Operation{}, fmt.Errorf("invalid dev watch name: %s", opts.Name)
+	}
+
+	if opts.Restart {
+		cfg, err := profile.GetLaunchConfig(opts.GameTitle, opts.ProfileName)
+		if err != nil {
+			return operations.Operation{}, err
+		}
+		if cfg.Launcher != profile.LAUNCHER_DIRECT {
+			return operations.Operation{}, fmt.Errorf("cannot restart the game with the %s launcher. use the direct launcher instead", cfg.Launcher)
+		}
+	}
+
+	linkDir, err := loaders.GetModLinkPath(opts.Loader, profile.PathToProfile(opts.GameTitle, opts.ProfileName))
+	if err != nil {
+		return operations.Operation{}, err
+	}
+
+	manifest, err := profile.GetManifest(opts.GameTitle, opts.ProfileName)
+	if err != nil {
+		return operations.Operation{}, err
+	}
+
+	for _, mods := range manifest.Mods {
+		if slices.ContainsFunc(mods, func(mod string) bool { return strings.EqualFold(mod, opts.Name) }) {
+			return operations.Operation{}, fmt.Errorf("%s is already a mod in this profile. choose a different name", opts.Name)
+		}
+	}
+
+	path := filepath.Join(linkDir, opts.Name)
+
+	devWatchMutex.Lock()
+	defer devWatchMutex.Unlock()
+
+	for _, op := range ListDevWatches() {
+		if op.Name == path {
+			return operations.Operation{}, fmt.Errorf("%s is already being watched into", path)
+		}
+	}
+
+	if err := checkDevWatchPath(path, opts.BuildDir); err != nil {
+		return operations.Operation{}, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return operations.Operation{}, err
+	}
+
+	if err := watchDirTree(watcher, opts.BuildDir); err != nil {
+		watcher.Close()
+		return operations.Operation{}, fmt.Errorf("failed to watch build dir:\n%v", err)
+	}
+
+	ctx, op := operations.Start(operations.OP_DEV_WATCH, path)
+	w := &devWatch{opts: opts, path: path, op: op, watcher: watcher}
+	started := *op
+
+	go w.run(ctx)
+
+	// So the profile is up to date before the first change.
+	operations.Signal(op.ID)
+	return started, nil
+}
+
+// Syncs the watched build dir as soon as possible, regardless of whether it has changed.
+func TriggerDevWatch(id string) error {
+	return operations.Signal(id)
+}
+
+// Stops the dev watch with the given id. Synced files are left in the profile so the mod can still be played,
+// but a link to the build dir is removed before the watch finishes, as nothing would keep it up to date.
+//
+// A game started by the watch is left running.
+func StopDevWatch(id string) error {
+	return operations.Cancel(id)
+}
+
+// Returns the operation of every running dev watch, oldest first. The name of each is the path it syncs into.
+func ListDevWatches() []operations.Operation {
+	watches := []operations.Operation{}
+	for _, op := range operations.List() {
+		if op.Kind == operations.OP_DEV_WATCH {
+			watches = append(watches, op)
+		}
+	}
+
+	return watches
+}
+
+// Refuses paths that already hold something other than the output of a dev watch into the same build dir,
+// being either a link to it or a dir with our marker in it.
+func checkDevWatchPath(path, buildDir string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if fileutil.IsDirLink(path) {
+		if source, err := fileutil.ReadDirLink(path); err == nil && filepath.Clean(source) == filepath.Clean(buildDir) {
+			return nil
+		}
+	} else if exists, _ := fileutil.ExistsAtPath(filepath.Join(path, DEV_WATCH_MARKER_NAME)); exists {
+		return nil
+	}
+
+	return fmt.Errorf("%s already exists and wasn't made by a dev watch. choose a different name", path)
+}
+
+func (w *devWatch) run(ctx context.Context) {
+	var err error
+	defer w.op.Finish(&err)
+	defer w.watcher.Close()
+	defer func() {
+		err = errors.Join(err, w.unlink())
+	}()
+
+	debounce := time.NewTimer(DEV_WATCH_DEBOUNCE)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				err = errors.New("stopped receiving changes to the build dir")
+				return
+			}
+
+			// Dirs created after we started aren't watched on their own.
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watchDirTree(w.watcher, event.Name)
+				}
+			}
+
+			debounce.Reset(DEV_WATCH_DEBOUNCE)
+		case watchErr, ok := <-w.watcher.Errors:
+			if !ok {
+				err = errors.New("stopped receiving changes to the build dir")
+				return
+			}
+
+			w.op.Update(fmt.Sprintf("error watching build dir: %v", watchErr))
+		case <-w.op.Signals():
+			debounce.Stop()
+			w.sync()
+		case <-debounce.C:
+			w.sync()
+		}
+	}
+}
+
+// Brings the build output into the profile, stopping the game first (if we started it) so none of its files are in use,
+// then starts it again if restarting is enabled. The outcome is reported as the status of the watch's operation.
+func (w *devWatch) sync() {
+	changed := 0
+
+	err := w.stopGame()
+	if err == nil {
+		changed, err = w.apply()
+	}
+
+	if err == nil && w.opts.Restart {
+		err = w.startGame()
+	}
+
+	switch {
+	case err != nil:
+		w.op.Update(fmt.Sprintf("sync failed: %v", err))
+	case w.opts.Mode == DEV_WATCH_LINK:
+		w.op.Update("linked build dir")
+	default:
+		w.op.Update(fmt.Sprintf("synced %d changed files", changed))
+	}
+}
+
+func (w *devWatch) apply() (int, error) {
+	if w.opts.Mode == DEV_WATCH_LINK {
+		if source, err := fileutil.ReadDirLink(w.path); err == nil && filepath.Clean(source) == filepath.Clean(w.opts.BuildDir) {
+			return 0, nil
+		}
+
+		// Either a link made by an earlier run or a dir synced by one, as anything else was refused on start.
+		if err := w.remove(); err != nil {
+			return 0, err
+		}
+
+		// A fresh profile may not have the loader's mod dir yet.
+		if err := fileutil.MkDirAll(filepath.Dir(w.path)); err != nil {
+			return 0, err
+		}
+
+		return 0, fileutil.LinkDir(w.path, w.opts.BuildDir)
+	}
+
+	// Left over from watching in link mode, and syncing through it would copy the build dir onto itself.
+	if fileutil.IsDirLink(w.path) {
+		if err := fileutil.UnlinkDir(w.path); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := fileutil.MkDirAll(w.path); err != nil {
+		return 0, err
+	}
+
+	// Marked before syncing, so a sync that fails halfway still leaves a dir the next watch will take over.
+	if err := fileutil.WriteFile(filepath.Join(w.path, DEV_WATCH_MARKER_NAME), []byte(w.opts.BuildDir)); err != nil {
+		return 0, err
+	}
+
+	return fileutil.SyncDir(w.opts.BuildDir, w.path, DEV_WATCH_MARKER_NAME)
+}
+
+func (w *devWatch) remove() error {
+	if fileutil.IsDirLink(w.path) {
+		return fileutil.UnlinkDir(w.path)
+	}
+
+	if err := os.RemoveAll(w.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the link to the build dir once the watch stops. Synced dirs are kept so the mod can still be played.
+func (w *devWatch) unlink() error {
+	if w.opts.Mode != DEV_WATCH_LINK || !fileutil.IsDirLink(w.path) {
+		return nil
+	}
+
+	if err := fileutil.UnlinkDir(w.path); err != nil {
+		return fmt.Errorf("failed to remove link to build dir:\n%w", err)
+	}
+
+	return nil
+}
+
+func (w *devWatch) startGame() error {
+	opts := w.opts
+
+	cfg, err := profile.GetLaunchConfig(opts.GameTitle, opts.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	args, err := GetProfileLaunchArgs(opts.Loader, opts.GameTitle, opts.ProfileName, *cfg, true)
+	if err != nil {
+		return err
+	}
+
+	cmd, statusChan, err := runners.LaunchGameDirect(opts.Target.ExePath, args, cfg.EnvList())
+	if err != nil {
+		return err
+	}
+
+	w.game = cmd
+	go recordPlaySession(opts.GameTitle, opts.ProfileName, statusChan)
+
+	// Only informational, so a failure here shouldn't be reported as a failed launch.
+	profile.MarkProfilePlayed(opts.GameTitle, opts.ProfileName, time.Now())
+	return nil
+}
+
+// Stops the game if we started it and waits for it to exit. Does nothing if it has already exited.
+func (w *devWatch) stopGame() error {
+	if w.game == nil {
+		return nil
+	}
+
+	game := w.game
+	w.game = nil
+
+	// Not started means it failed to, so there is nothing to stop.
+	if err := game.Stop(); err != nil && !errors.Is(err, gocmd.ErrNotStarted) {
+		return fmt.Errorf("failed to stop game:\n%v", err)
+	}
+
+	<-game.Done()
+	return nil
+}
+
+// Watches the given dir along with every dir inside of it, as watches only cover the immediate contents of a dir.
+func watchDirTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return watcher.Add(path)
+		}
+
+		return nil
+	})
+}
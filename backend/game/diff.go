@@ -0,0 +1,192 @@
+package game
+
+import (
+	"modm8/backend/common/fileutil"
+	"modm8/backend/loaders"
+	"modm8/backend/profile"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A single config entry that differs between two profiles.
+// From or To is nil when the entry (or its whole file) only exists on one side.
+type ConfigChange struct {
+	// Slash-separated path of the config file relative to the profile dir. Ex: "BepInEx/config/IntroTweaks.cfg"
+	File string `json:"file"`
+	// The flattened key of the entry including its section. Ex: "General.Enabled"
+	Key  string  `json:"key"`
+	From *string `json:"from"`
+	To   *string `json:"to"`
+}
+
+type ProfileDiff struct {
+	Mods    profile.ManifestDiff `json:"mods"`
+	Configs []ConfigChange       `json:"configs"`
+}
+
+// Compares two profiles of the same game, from the perspective of going from fromProfile to toProfile.
+func (gm *GameManager) DiffProfiles(loader loaders.ModLoaderType, gameTitle, fromProfile, toProfile string) (*ProfileDiff, error) {
+	return DiffProfiles(loader, gameTitle, fromProfile, toProfile)
+}
+
+// Compares a profile against a profile archive (.m8p) or r2modman export (.r2z) without importing it.
+func (gm *GameManager) DiffProfileWithArchive(loader loaders.ModLoaderType, gameTitle, profileName, archivePath string) (*ProfileDiff, error) {
+	return DiffProfileWithArchive(loader, gameTitle, profileName, archivePath)
+}
+
+// Shows how the mods and configs of the profile have changed since the given snapshot.
+func (gm *GameManager) DiffProfileWithSnapshot(loader loaders.ModLoaderType, gameTitle, profileName, id string) (*ProfileDiff, error) {
+	return DiffProfileWithSnapshot(loader, gameTitle, profileName, id)
+}
+
+func DiffProfiles(loader loaders.ModLoaderType, gameTitle, fromProfile, toProfile string) (*ProfileDiff, error) {
+	fromManifest, fromFiles, err := readProfileForDiff(loader, gameTitle, fromProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	toManifest, toFiles, err := readProfileForDiff(loader, gameTitle, toProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProfileDiff{
+		Mods:    profile.DiffManifests(*fromManifest, *toManifest),
+		Configs: DiffBepinexConfigs(fromFiles, toFiles),
+	}, nil
+}
+
+func DiffProfileWithArchive(loader loaders.ModLoaderType, gameTitle, profileName, archivePath string) (*ProfileDiff, error) {
+	manifest, files, err := readProfileForDiff(loader, gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var archiveManifest profile.ProfileManifest
+	var archiveFiles map[string][]byte
+
+	if strings.EqualFold(filepath.Ext(archivePath), profile.R2_PROFILE_EXT) {
+		data, err := fileutil.ReadFile(archivePath)
+		if err != nil {
+			return nil, err
+		}
+
+		export, r2Files, err := profile.ReadR2Archive(data)
+		if err != nil {
+			return nil, err
+		}
+
+		archiveManifest, archiveFiles = export.ToManifest(), r2Files
+	} else {
+		archive, err := profile.ReadProfileArchive(archivePath)
+		if err != nil {
+			return nil, err
+		}
+
+		archiveManifest, archiveFiles = archive.Manifest, archive.Files
+	}
+
+	return &ProfileDiff{
+		Mods:    profile.DiffManifests(*manifest, archiveManifest),
+		Configs: DiffBepinexConfigs(files, archiveFiles),
+	}, nil
+}
+
+// Compares a snapshot against the profile as it is now, from the perspective of going from the snapshot to the current profile.
+// Restoring the snapshot would undo exactly these changes.
+//
+// Snapshots are profile archives, so this is [DiffProfileWithArchive] turned around to go from the snapshot to the profile.
+func DiffProfileWithSnapshot(loader loaders.ModLoaderType, gameTitle, profileName, id string) (*ProfileDiff, error) {
+	archive, err := profile.ReadProfileArchive(profile.PathToSnapshot(gameTitle, profileName, id))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, files, err := readProfileForDiff(loader, gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProfileDiff{
+		Mods:    profile.DiffManifests(archive.Manifest, *manifest),
+		Configs: DiffBepinexConfigs(archive.Files, files),
+	}, nil
+}
+
+func readProfileForDiff(loader loaders.ModLoaderType, gameTitle, profileName string) (*profile.ProfileManifest, map[string][]byte, error) {
+	manifest, err := profile.GetManifest(gameTitle, profileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := profile.ReadProfileConfigFiles(loader, gameTitle, profileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return manifest, files, nil
+}
+
+// Parses every BepInEx config (.cfg) in both sets of files with [ParseBepinexConfigData] and compares them entry by entry.
+// Files are keyed by their slash-separated path relative to the profile dir. Any other files are ignored.
+func DiffBepinexConfigs(fromFiles, toFiles map[string][]byte) []ConfigChange {
+	changes := []ConfigChange{}
+
+	var names []string
+	for _, files := range []map[string][]byte{fromFiles, toFiles} {
+		for name := range files {
+			if strings.EqualFold(path.Ext(name), ".cfg") && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		fromEntries := parseConfigEntries(fromFiles[name])
+		toEntries := parseConfigEntries(toFiles[name])
+
+		var keys []string
+		for key := range fromEntries {
+			keys = append(keys, key)
+		}
+		for key := range toEntries {
+			if _, ok := fromEntries[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			fromEntry, inFrom := fromEntries[key]
+			toEntry, inTo := toEntries[key]
+			if inFrom && inTo && fromEntry.Value == toEntry.Value {
+				continue
+			}
+
+			change := ConfigChange{File: name, Key: key}
+			if inFrom {
+				change.From = &fromEntry.Value
+			}
+			if inTo {
+				change.To = &toEntry.Value
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+func parseConfigEntries(contents []byte) map[string]BepinexConfigEntry {
+	if contents == nil {
+		return map[string]BepinexConfigEntry{}
+	}
+
+	return ParseBepinexConfigData(contents).Entries
+}
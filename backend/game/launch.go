@@ -0,0 +1,125 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	runners "modm8/backend/launchers"
+	"modm8/backend/launchers/epic"
+	"modm8/backend/launchers/steam"
+	"modm8/backend/loaders"
+	"modm8/backend/profile"
+	"strings"
+	"time"
+
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// Identifies the game on every launcher it could be started through.
+// Only the one matching the launcher in the profile's launch config is required.
+type LaunchTarget struct {
+	SteamID uint32 `json:"steam_id"`
+	EpicID  string `json:"epic_id"`
+	ExePath string `json:"exe_path"`
+}
+
+func (gm *GameManager) LaunchProfile(loader loaders.ModLoaderType, gameTitle, profileName string, target LaunchTarget, modded bool) error {
+	return LaunchProfile(loader, gameTitle, profileName, target, modded)
+}
+
+// Builds the full list of args used to launch the given profile, being the loader args followed by the game args of its launch config.
+//
+// The loader args come from [loaders.GetLoaderInstructions] unless the launch config overrides them.
+func GetProfileLaunchArgs(loader loaders.ModLoaderType, gameTitle, profileName string, cfg profile.ProfileLaunchConfig, modded bool) ([]string, error) {
+	args := []string{}
+
+	if cfg.LoaderArgs != nil {
+		args = append(args, *cfg.LoaderArgs...)
+	} else {
+		instructions, err := loaders.GetLoaderInstructions(loader, profile.PathToProfile(gameTitle, profileName))
+		if err != nil {
+			return nil, err
+		}
+
+		if modded {
+			args = append(args, instructions.ModdedParams...)
+		} else {
+			args = append(args, instructions.VanillaParams...)
+		}
+	}
+
+	return append(args, cfg.GameArgs...), nil
+}
+
+// Starts the game with the given profile, using the launcher, args and env from the profile's launch config.
+//
+// The launch is recorded as the last time the profile was played. Playtime is only recorded for direct launches,
+// since store launchers hand the game off to another process that we can't keep track of.
+//
+// Epic does not support launch args, so its launch configs must have none to pass. See [profile.SaveLaunchConfig].
+func LaunchProfile(loader loaders.ModLoaderType, gameTitle, profileName string, target LaunchTarget, modded bool) error {
+	if exists, _ := profile.ProfileExists(gameTitle, profileName); !exists {
+		return fmt.Errorf("profile '%s' does not exist", profileName)
+	}
+
+	cfg, err := profile.GetLaunchConfig(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	args, err := GetProfileLaunchArgs(loader, gameTitle, profileName, *cfg, modded)
+	if err != nil {
+		return err
+	}
+
+	err = launchWithConfig(gameTitle, profileName, *cfg, target, args)
+	if err != nil {
+		return err
+	}
+
+	// Only informational, so a failure here shouldn't be reported as a failed launch.
+	profile.MarkProfilePlayed(gameTitle, profileName, time.Now())
+	return nil
+}
+
+func launchWithConfig(gameTitle, profileName string, cfg profile.ProfileLaunchConfig, target LaunchTarget, args []string) error {
+	switch cfg.Launcher {
+	case profile.LAUNCHER_STEAM:
+		if target.SteamID == 0 {
+			return errors.New("cannot launch profile with steam. game has no steam id")
+		}
+
+		return steam.SteamLauncher{}.LaunchGame(target.SteamID, args)
+	case profile.LAUNCHER_EPIC:
+		if strings.TrimSpace(target.EpicID) == "" {
+			return errors.New("cannot launch profile with epic. game has no epic id")
+		}
+		// Only reachable by editing the launch config by hand, as saving it refuses this.
+		if len(args) > 0 {
+			return profile.ErrEpicLaunchArgs
+		}
+
+		_, err := epic.LaunchGame(target.EpicID)
+		return err
+	case profile.LAUNCHER_DIRECT:
+		_, statusChan, err := runners.LaunchGameDirect(target.ExePath, args, cfg.EnvList())
+		if err != nil {
+			return err
+		}
+
+		go recordPlaySession(gameTitle, profileName, statusChan)
+		return nil
+	}
+
+	return fmt.Errorf("unknown launcher: %s", cfg.Launcher)
+}
+
+// Waits for a directly launched game to exit, then adds the time it ran for to the profile's playtime.
+func recordPlaySession(gameTitle, profileName string, statusChan <-chan gocmd.Status) {
+	status := <-statusChan
+	if status.StartTs == 0 || status.StopTs == 0 {
+		return
+	}
+
+	played := time.Duration(status.StopTs - status.StartTs)
+	profile.AddProfilePlaytime(gameTitle, profileName, played)
+}
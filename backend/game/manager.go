@@ -1,21 +1,61 @@
 package game
 
 import (
+	"fmt"
+	"modm8/backend/app/appcore"
 	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
 	"modm8/backend/common/paths"
 	"modm8/backend/installing"
 	"modm8/backend/loaders"
 	"modm8/backend/profile"
-	"os"
 	"path/filepath"
 )
 
 type GameManager struct {
 	//SelectedGame
+	validator   installing.PackageValidator
+	appSettings *appcore.AppSettings
 }
 
-func NewGameManager() *GameManager {
-	return &GameManager{}
+func NewGameManager(appSettings *appcore.AppSettings) *GameManager {
+	return &GameManager{appSettings: appSettings}
+}
+
+// Sets the validator local mods must pass before they can be imported. See [GameManager.ImportLocalMod].
+func (gm *GameManager) SetPackageValidator(validator installing.PackageValidator) {
+	gm.validator = validator
+}
+
+// Imports a local zip or folder into the mod cache of the given game without adding it to any profile,
+// returning the full name it can be linked by. See [installing.ImportLocalPackage].
+func (gm *GameManager) ImportLocalMod(gameTitle, path string) (verFullName string, err error) {
+	if gm.validator == nil {
+		return "", fmt.Errorf("cannot import local mod. no package validator has been set")
+	}
+
+	ctx, op := operations.Start(operations.OP_IMPORT, filepath.Base(path))
+	defer op.Finish(&err)
+
+	return installing.ImportLocalPackage(ctx, gm.validator, path, paths.GameModCacheDir(gameTitle))
+}
+
+// Starts syncing the build output of a mod into a profile whenever it changes. See [StartDevWatch].
+func (gm *GameManager) StartDevWatch(opts DevWatchOptions) (operations.Operation, error) {
+	return StartDevWatch(opts)
+}
+
+// Syncs a dev watch (and restarts the game, if enabled) without waiting for the build dir to change.
+func (gm *GameManager) TriggerDevWatch(id string) error {
+	return TriggerDevWatch(id)
+}
+
+func (gm *GameManager) StopDevWatch(id string) error {
+	return StopDevWatch(id)
+}
+
+func (gm *GameManager) ListDevWatches() []operations.Operation {
+	return ListDevWatches()
 }
 
 func (gm *GameManager) GetModLinkPath(loader loaders.ModLoaderType, profileDir string) (string, error) {
@@ -43,28 +83,21 @@ func (gm *GameManager) GetModLoaderInstructions(loader loaders.ModLoaderType, pr
 // For example, we can mirror target "../modm8/Games/GameTitle/Profiles/test/BepInEx/plugins/Owen3H-IntroTweaks-1.5.0" to the
 // source "../modm8/Games/GameTitle/ModCache/Owen3H-IntroTweaks-1.5.0" which would give us the desired behaviour.
 func (gm *GameManager) LinkModToProfile(loader loaders.ModLoaderType, gameTitle, profileName, modFullName string) error {
-	profileModsDir, err := loaders.GetModLinkPath(loader, profile.PathToProfile(gameTitle, profileName))
-	if err != nil {
-		return err
-	}
-
 	// TODO: Read manifest.json in the mod's folder and call this function recursively for
 	// 		 each mod specified within the `dependencies` field.
+	if err := profile.AutoSnapshot(gm.appSettings, gameTitle, profileName, profile.SNAPSHOT_REASON_INSTALL); err != nil {
+		return err
+	}
 
-	target := filepath.Join(profileModsDir, modFullName)      // Path to mod in given profile dir
-	source := filepath.Join(paths.ModCacheDir(), modFullName) // Path to mod in mod cache.
-
-	return fileutil.LinkDir(target, source)
+	return profile.LinkMod(loader, gameTitle, profileName, modFullName)
 }
 
 func (gm *GameManager) UnlinkModFromProfile(loader loaders.ModLoaderType, gameTitle, profileName, modFullName string) error {
-	profileModsDir, err := loaders.GetModLinkPath(loader, profile.PathToProfile(gameTitle, profileName))
-	if err != nil {
+	if err := profile.AutoSnapshot(gm.appSettings, gameTitle, profileName, profile.SNAPSHOT_REASON_REMOVE); err != nil {
 		return err
 	}
 
-	target := filepath.Join(profileModsDir, modFullName) // Path to mod in given profile dir
-	return os.Remove(target)
+	return profile.UnlinkMod(loader, gameTitle, profileName, modFullName)
 }
 
 func (gm *GameManager) GameInstalled(dirPath string, exeKeywords []string) bool {
@@ -1,6 +1,7 @@
 package installing
 
 import (
+	"context"
 	"modm8/backend/common/downloader"
 	"modm8/backend/common/fileutil"
 	"os"
@@ -15,7 +16,7 @@ type BepinexModInstaller struct {
 const BEPINEX_ZIP_OUTPUT_NAME = "BepInEx-Setup"
 const BEPINEX_ROOT_NAME = "BepInEx"
 
-func (ins *BepinexModInstaller) Install(downloadURL, fullName, cacheDir string) (*grab.Response, error) {
+func (ins *BepinexModInstaller) Install(ctx context.Context, meta PackageInstallMeta, cacheDir string) (*grab.Response, error) {
 	// Install own loader package.
 	// if loaders.IsLoaderPackage(loaders.BEPINEX, fullName) {
 	// 	profDir := profile.PathToProfile(gameTitle, profName)
@@ -24,8 +25,7 @@ func (ins *BepinexModInstaller) Install(downloadURL, fullName, cacheDir string)
 	// }
 
 	// Download zip and extract contents in a new mod dir.
-	path := filepath.Join(cacheDir, fullName)
-	res, err := downloader.DownloadAndUnzip(downloadURL, path, true)
+	res, err := InstallToCache(ctx, meta, cacheDir)
 	if err != nil {
 		return res, err
 	}
@@ -43,42 +43,41 @@ func (ins *BepinexModInstaller) Uninstall(fullName, dir string) error {
 }
 
 // Installs BepInEx's own loader package at `path`, which is usually points to a profile dir.
-func InstallBepinexPack(downloadURL, path string) (*grab.Response, error) {
-	res, err := downloader.DownloadAndUnzip(downloadURL, path, true)
-	if err != nil {
-		return res, err
-	}
+//
+// The pack is extracted and normalized in a staging dir first, so `path` only appears once it is fully set up.
+func InstallBepinexPack(ctx context.Context, downloadURL, path string) (*grab.Response, error) {
+	return downloader.DownloadAndUnzipContext(ctx, downloadURL, path, downloader.DownloadOptions{
+		DeleteArchive: true,
+		BeforeCommit:  normalizeBepinexPack,
+	})
+}
 
+// Moves the contents of the BepInExPack dir inside the extracted pack up into its root, where the game expects them.
+func normalizeBepinexPack(root string) error {
 	// BepInExPack should exist in what we just unzipped.
-	bepinexPackDir := filepath.Join(path, "BepInExPack")
+	bepinexPackDir := filepath.Join(root, "BepInExPack")
 
 	// All files/dirs within the pack.
 	entries, err := os.ReadDir(bepinexPackDir)
 	if err != nil {
-		return res, err
+		return err
 	}
 
 	// We now have a setup dir with BepInExPack inside of it.
-	// The contents of BepInExPack need to go up 2 into the base profile dir.
+	// The contents of BepInExPack need to go up into the base dir.
 	for _, entry := range entries {
 		srcPath := filepath.Join(bepinexPackDir, entry.Name())
-		dstPath := filepath.Join(path, entry.Name())
+		dstPath := filepath.Join(root, entry.Name())
 
-		err = os.Rename(srcPath, dstPath)
-		if err != nil {
-			return res, err
+		if err := os.Rename(srcPath, dstPath); err != nil {
+			return err
 		}
 	}
 
-	fileutil.MkDir(filepath.Join(path, BEPINEX_ROOT_NAME, "plugins"))
+	fileutil.MkDir(filepath.Join(root, BEPINEX_ROOT_NAME, "plugins"))
 
 	// Then the leftover original bepinex setup dir can now be deleted.
-	err = os.RemoveAll(bepinexPackDir)
-	if err != nil {
-		return res, err
-	}
-
-	return res, err
+	return os.RemoveAll(bepinexPackDir)
 }
 
 // Installs a mod with the assumption all dlls, configs etc. exist at the top-level.
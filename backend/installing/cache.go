@@ -0,0 +1,453 @@
+package installing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/fileutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cavaliergopher/grab/v3"
+)
+
+// Lives inside every mod cache dir. Hidden so it's never mistaken for a mod.
+const cacheIndexName = ".index.json"
+
+// Returned when an extracted package isn't laid out like a mod, such as having no manifest.json.
+var ErrInvalidPackage = errors.New("invalid package")
+
+// Guards read-modify-write updates to cache indexes, since mods can be installed concurrently.
+var cacheIndexMutex sync.Mutex
+
+// Records what every mod in a mod cache dir should look like, keyed by the name of the mod's dir.
+type CacheIndex struct {
+	Entries map[string]CacheIndexEntry `json:"entries"`
+}
+
+type CacheIndexEntry struct {
+	DownloadURL   string `json:"download_url"`
+	ArchiveSHA256 string `json:"archive_sha256"`
+	FileCount     int    `json:"file_count"`
+	Size          int64  `json:"size"`
+	// See [fileutil.HashDir].
+	TreeSHA256 string `json:"tree_sha256"`
+	// Only set once the mod has been fully extracted. An entry that isn't complete was interrupted part way through.
+	Complete bool      `json:"complete"`
+	CachedAt time.Time `json:"cached_at"`
+}
+
+type CacheIssueCategory string
+
+const (
+	// Was still being installed when the app closed or failed to install.
+	CACHE_ISSUE_INCOMPLETE CacheIssueCategory = "INCOMPLETE"
+	// Files were added, removed or modified since it was installed.
+	CACHE_ISSUE_MODIFIED CacheIssueCategory = "MODIFIED"
+	// Listed in the index but its dir no longer exists.
+	CACHE_ISSUE_MISSING CacheIssueCategory = "MISSING"
+	// Exists in the cache but isn't in the index, usually because it was installed before the index existed.
+	CACHE_ISSUE_UNINDEXED CacheIssueCategory = "UNINDEXED"
+)
+
+type CacheIssue struct {
+	Category    CacheIssueCategory `json:"category"`
+	VerFullName string             `json:"ver_full_name"`
+}
+
+func PathToCacheIndex(cacheDir string) string {
+	return filepath.Join(cacheDir, cacheIndexName)
+}
+
+// Returns the index of the given mod cache dir, or an empty index if it doesn't have one yet.
+func GetCacheIndex(cacheDir string) (*CacheIndex, error) {
+	index := CacheIndex{Entries: map[string]CacheIndexEntry{}}
+
+	contents, err := fileutil.ReadFile(PathToCacheIndex(cacheDir))
+	if os.IsNotExist(err) {
+		return &index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", cacheIndexName, err)
+	}
+
+	if index.Entries == nil {
+		index.Entries = map[string]CacheIndexEntry{}
+	}
+
+	return &index, nil
+}
+
+func SaveCacheIndex(cacheDir string, index CacheIndex) error {
+	data, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.MkDirAll(cacheDir); err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(PathToCacheIndex(cacheDir), data)
+}
+
+// Loads the index of the given mod cache dir, passes it to fn and saves the result, all while holding the index lock.
+func UpdateCacheIndex(cacheDir string, fn func(index *CacheIndex)) error {
+	cacheIndexMutex.Lock()
+	defer cacheIndexMutex.Unlock()
+
+	index, err := GetCacheIndex(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	fn(index)
+	return SaveCacheIndex(cacheDir, *index)
+}
+
+// Downloads and extracts a mod into the given mod cache dir, recording it in the cache index as it goes.
+//
+// The entry is marked incomplete before anything is downloaded and only marked complete once extraction has finished,
+// so an install that gets interrupted can be told apart from a finished one. If the mod already exists in the cache
+// but its entry is incomplete, it is removed and installed again rather than refused.
+//
+// Progress is reported under the mod's full name. See [downloader.TrackProgress].
+//
+// The archive is checked against the size and hash in meta (where known) before anything is extracted.
+// If it doesn't match, a [downloader.VerificationError] is returned and the mod is not cached.
+// Once extracted, it must have a manifest.json (see [ErrInvalidPackage]) before it is moved into the cache.
+//
+// If the same mod is already being installed, this waits on that install instead (see [downloader.DownloadAndUnzipContext]),
+// then checks the hash it recorded against the one in meta. Only the install that did the work touches the cache or its index.
+//
+// If every caller waiting on the install cancels its ctx, the install is stopped and rolled back, leaving no trace of the mod
+// in the cache or its index.
+func InstallToCache(ctx context.Context, meta PackageInstallMeta, cacheDir string) (res *grab.Response, err error) {
+	downloadURL, fullName := meta.DownloadURL, meta.FullName
+	path := filepath.Join(cacheDir, fullName)
+
+	task, owned := downloader.TrackProgress(fullName)
+	if owned {
+		defer func() { task.Finish(err) }()
+	}
+
+	// Only set when this call's options are the ones the install runs with, rather than it waiting on another install.
+	ran := false
+
+	var archiveHash string
+	res, err = downloader.DownloadAndUnzipContext(ctx, downloadURL, path, downloader.DownloadOptions{
+		DeleteArchive:  true,
+		Progress:       task,
+		ExpectedSize:   meta.FileSize,
+		ExpectedSHA256: meta.SHA256,
+		Prepare: func() error {
+			ran = true
+			return prepareCachedMod(cacheDir, fullName, downloadURL)
+		},
+		BeforeExtract: func(archivePath string) (err error) {
+			// Already verified to match, no need to hash it twice.
+			if meta.SHA256 != "" {
+				archiveHash = strings.ToLower(meta.SHA256)
+				return nil
+			}
+
+			archiveHash, err = fileutil.HashFile(archivePath)
+			return err
+		},
+		BeforeCommit: normalizeCachedMod,
+		Finish: func(ctx context.Context, err error) error {
+			// A bad download or package never made it into the cache, so there's nothing worth keeping.
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, downloader.ErrCorruptDownload) || errors.Is(err, ErrInvalidPackage) {
+					rollbackCachedMod(cacheDir, fullName)
+				}
+
+				return err
+			}
+
+			return completeCachedMod(cacheDir, fullName, downloadURL, archiveHash)
+		},
+	})
+
+	// Checked before ran, which is only safe to read once the install has finished.
+	if err != nil || ran || meta.SHA256 == "" {
+		return res, err
+	}
+
+	return res, checkCachedArchiveHash(cacheDir, fullName, meta.SHA256)
+}
+
+// Makes sure an extracted mod has its manifest.json at the root, moving everything up out of the package's own dir
+// if it was zipped inside one. Anything without a manifest is refused with [ErrInvalidPackage] so it never reaches the cache.
+func normalizeCachedMod(stagingPath string) error {
+	root := findPackageRoot(stagingPath)
+	if exists, _ := fileutil.ExistsInDir(root, "manifest.json"); !exists {
+		return fmt.Errorf("%w: no manifest.json at its root", ErrInvalidPackage)
+	}
+
+	if root == stagingPath {
+		return nil
+	}
+
+	// Moved aside first, as the dir could contain something with the same name as itself.
+	nested := filepath.Join(stagingPath, ".m8nested")
+	if err := os.Rename(root, nested); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(nested)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(nested, entry.Name()), filepath.Join(stagingPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(nested)
+}
+
+// Gets the cache ready for a mod to be installed into it, removing an incomplete install of it and marking it as incomplete.
+func prepareCachedMod(cacheDir, fullName, downloadURL string) error {
+	path := filepath.Join(cacheDir, fullName)
+
+	index, err := GetCacheIndex(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	if entry, ok := index.Entries[fullName]; ok && !entry.Complete {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove incomplete install of %s: %v", fullName, err)
+		}
+	}
+
+	// Fail early the same way the downloader would, so we don't mark an existing mod as incomplete.
+	if exists, _ := fileutil.ExistsAtPath(path); exists {
+		return fmt.Errorf("package '%s' already installed in %s", fullName, cacheDir)
+	}
+
+	return UpdateCacheIndex(cacheDir, func(index *CacheIndex) {
+		index.Entries[fullName] = CacheIndexEntry{DownloadURL: downloadURL, CachedAt: time.Now().UTC()}
+	})
+}
+
+// Records a mod that has just been extracted into the cache as complete.
+func completeCachedMod(cacheDir, fullName, downloadURL, archiveHash string) error {
+	entry, err := inspectCachedMod(filepath.Join(cacheDir, fullName))
+	if err != nil {
+		return err
+	}
+
+	entry.DownloadURL = downloadURL
+	entry.ArchiveSHA256 = archiveHash
+	entry.Complete = true
+
+	return UpdateCacheIndex(cacheDir, func(index *CacheIndex) {
+		index.Entries[fullName] = entry
+	})
+}
+
+// Checks the archive hash recorded for a mod installed by someone else against the one the caller expected.
+// The mod is left in place either way, since it is exactly what whoever installed it asked for.
+func checkCachedArchiveHash(cacheDir, fullName, expectedSHA256 string) error {
+	index, err := GetCacheIndex(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	actual := index.Entries[fullName].ArchiveSHA256
+	if !strings.EqualFold(actual, expectedSHA256) {
+		return &downloader.VerificationError{
+			ArchivePath: filepath.Join(cacheDir, fullName) + downloader.CUSTOM_ZIP_EXT,
+			Check:       downloader.VERIFY_SHA256,
+			Expected:    strings.ToLower(expectedSHA256),
+			Actual:      actual,
+		}
+	}
+
+	return nil
+}
+
+// Removes every trace of a mod that was only partially installed into the given mod cache dir.
+func rollbackCachedMod(cacheDir, fullName string) {
+	path := filepath.Join(cacheDir, fullName)
+	archivePath := path + downloader.CUSTOM_ZIP_EXT
+
+	os.RemoveAll(path)
+	os.Remove(archivePath)
+	os.Remove(archivePath + downloader.PARTIAL_EXT)
+
+	RemoveFromCacheIndex(cacheDir, fullName)
+}
+
+// Builds an index entry from whatever currently exists at the given path. The entry is not marked complete.
+func inspectCachedMod(path string) (CacheIndexEntry, error) {
+	entry := CacheIndexEntry{CachedAt: time.Now().UTC()}
+
+	err := filepath.WalkDir(path, func(p string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !dirEntry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+
+		entry.FileCount++
+		entry.Size += info.Size()
+		return nil
+	})
+
+	if err != nil {
+		return entry, err
+	}
+
+	entry.TreeSHA256, err = fileutil.HashDir(path)
+	return entry, err
+}
+
+// Checks every mod in the given mod cache dir against the cache index, returning any that are incomplete,
+// have been modified since being installed, are missing or aren't indexed at all.
+func VerifyModCache(cacheDir string) ([]CacheIssue, error) {
+	index, err := GetCacheIndex(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []CacheIssue{}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	onDisk := make(map[string]bool)
+	for _, dirEntry := range entries {
+		name := dirEntry.Name()
+		if !dirEntry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		onDisk[name] = true
+
+		indexed, ok := index.Entries[name]
+		if !ok {
+			issues = append(issues, CacheIssue{Category: CACHE_ISSUE_UNINDEXED, VerFullName: name})
+			continue
+		}
+
+		if !indexed.Complete {
+			issues = append(issues, CacheIssue{Category: CACHE_ISSUE_INCOMPLETE, VerFullName: name})
+			continue
+		}
+
+		actual, err := inspectCachedMod(filepath.Join(cacheDir, name))
+		if err != nil || actual.FileCount != indexed.FileCount || actual.Size != indexed.Size || actual.TreeSHA256 != indexed.TreeSHA256 {
+			issues = append(issues, CacheIssue{Category: CACHE_ISSUE_MODIFIED, VerFullName: name})
+		}
+	}
+
+	for name := range index.Entries {
+		if !onDisk[name] {
+			issues = append(issues, CacheIssue{Category: CACHE_ISSUE_MISSING, VerFullName: name})
+		}
+	}
+
+	return issues, nil
+}
+
+// Fixes every issue found by [VerifyModCache]. Incomplete and modified mods are deleted and fetched again from
+// the URL they were originally downloaded from, while missing mods are dropped from the index.
+//
+// Unindexed mods have nothing to be compared against, so they are trusted and added to the index as they are.
+// Returns the issues that could not be fixed, along with the errors that caused them.
+//
+// Cancelling ctx stops any re-fetch in progress, leaving the rest of the issues as they are.
+func RepairModCache(ctx context.Context, cacheDir string) ([]CacheIssue, error) {
+	issues, err := VerifyModCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := GetCacheIndex(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := []CacheIssue{}
+	var errs []error
+
+	for i, issue := range issues {
+		if ctx.Err() != nil {
+			remaining = append(remaining, issues[i:]...)
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		path := filepath.Join(cacheDir, issue.VerFullName)
+
+		switch issue.Category {
+		case CACHE_ISSUE_MISSING:
+			err = UpdateCacheIndex(cacheDir, func(index *CacheIndex) {
+				delete(index.Entries, issue.VerFullName)
+			})
+		case CACHE_ISSUE_UNINDEXED:
+			var entry CacheIndexEntry
+			entry, err = inspectCachedMod(path)
+			if err == nil {
+				entry.Complete = true
+				err = UpdateCacheIndex(cacheDir, func(index *CacheIndex) {
+					index.Entries[issue.VerFullName] = entry
+				})
+			}
+		case CACHE_ISSUE_INCOMPLETE, CACHE_ISSUE_MODIFIED:
+			prev := index.Entries[issue.VerFullName]
+			if prev.DownloadURL == "" {
+				err = fmt.Errorf("cannot re-fetch %s. no download URL was recorded", issue.VerFullName)
+				break
+			}
+
+			// Versions never change once published, so the archive should be identical to the one we had before.
+			meta := PackageInstallMeta{FullName: issue.VerFullName, DownloadURL: prev.DownloadURL, SHA256: prev.ArchiveSHA256}
+			if err = os.RemoveAll(path); err == nil {
+				_, err = InstallToCache(ctx, meta, cacheDir)
+			}
+		}
+
+		if err != nil {
+			remaining = append(remaining, issue)
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return remaining, fmt.Errorf("errors occurred repairing mod cache:\n%w", errors.Join(errs...))
+	}
+
+	return remaining, nil
+}
+
+// Drops the given mod from the index of the given mod cache dir, such as after it has been deleted.
+func RemoveFromCacheIndex(cacheDir, fullName string) error {
+	return UpdateCacheIndex(cacheDir, func(index *CacheIndex) {
+		delete(index.Entries, fullName)
+	})
+}
@@ -1,6 +1,7 @@
 package installing
 
 import (
+	"context"
 	"fmt"
 	"modm8/backend/loaders"
 	"strings"
@@ -17,6 +18,10 @@ type PackageInstallMeta struct {
 	Dependencies []string `json:"dependencies"`
 	// The URL where this package lives and can be retrieved.
 	DownloadURL string `json:"downloadURL"`
+	// The size in bytes of the archive at DownloadURL, if known. Used to reject truncated downloads.
+	FileSize int64 `json:"fileSize,omitempty"`
+	// The hex encoded SHA-256 hash of the archive at DownloadURL, if known. Used to reject corrupted downloads.
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 func (meta *PackageInstallMeta) HasVersionSuffix() bool {
@@ -25,7 +30,7 @@ func (meta *PackageInstallMeta) HasVersionSuffix() bool {
 
 type IModInstaller interface {
 	//InstallSelf(downloadURL, dir string) error
-	Install(downloadURL, fullName, dir string) (*grab.Response, error)
+	Install(ctx context.Context, meta PackageInstallMeta, dir string) (*grab.Response, error)
 	Uninstall(fullName, dir string) error
 	//Extract() error
 }
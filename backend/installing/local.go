@@ -0,0 +1,187 @@
+package installing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stands in for the author of mods imported from disk, so they can never collide with a mod from Thunderstore.
+const LOCAL_NAMESPACE = "local"
+
+// Checks the files every package must have, the same way Thunderstore would on upload.
+// Satisfied by the Thunderstore package validator, which can't be imported here without a cycle.
+type PackageValidator interface {
+	ValidateManifest(author string, data []byte) (bool, []error, error)
+	ValidateReadme(data []byte) (bool, []error, error)
+	ValidateIcon(data []byte) (bool, error)
+}
+
+// Only what's needed to name a local package. See [PackageValidator.ValidateManifest] for the rest.
+type localPackageManifest struct {
+	Name          string `json:"name"`
+	VersionNumber string `json:"version_number"`
+}
+
+// Returns the full name a package with the given name and version is imported under. Ex: "local-IntroTweaks-1.6.0"
+func LocalFullName(name, version string) string {
+	return LOCAL_NAMESPACE + "-" + name + "-" + version
+}
+
+// Reports whether the given full name belongs to a package imported from disk rather than downloaded.
+func IsLocalPackage(fullName string) bool {
+	return strings.HasPrefix(strings.ToLower(fullName), LOCAL_NAMESPACE+"-")
+}
+
+// Imports a package from a local archive (any format supported by [fileutil.ExtractArchive]) or folder into the
+// given mod cache dir under the local namespace, returning the full name it was imported as. See [LocalFullName].
+//
+// The package must pass validation (manifest.json, README.md and icon.png at its root) before anything is added to the cache.
+// Archives wrapping everything in a single top-level folder are accepted too, as that's how most zip tools make them.
+//
+// Importing the same version again replaces the previous import, since unreleased builds are usually tested without bumping the version.
+func ImportLocalPackage(ctx context.Context, validator PackageValidator, sourcePath, cacheDir string) (string, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	stagingPath, err := fileutil.NewStagingDir(filepath.Join(cacheDir, LOCAL_NAMESPACE))
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stagingPath)
+
+	if info.IsDir() {
+		err = fileutil.CopyDir(sourcePath, stagingPath)
+	} else {
+		err = fileutil.ExtractArchiveContext(ctx, sourcePath, stagingPath, nil)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read package at %s:\n%v", sourcePath, err)
+	}
+
+	root := findPackageRoot(stagingPath)
+	manifest, err := validateLocalPackage(validator, root)
+	if err != nil {
+		return "", err
+	}
+
+	fullName := LocalFullName(manifest.Name, manifest.VersionNumber)
+	path := filepath.Join(cacheDir, fullName)
+
+	// Keep the previous import until the new one is in place, so a failure never leaves neither.
+	// It goes next to the staging dir rather than in it, as the staging dir itself may be what gets committed.
+	var previous string
+	if exists, _ := fileutil.ExistsAtPath(path); exists {
+		previous = stagingPath + "-old"
+		if err := os.Rename(path, previous); err != nil {
+			return "", fmt.Errorf("failed to replace previous import of %s:\n%v", fullName, err)
+		}
+	}
+
+	if err := fileutil.CommitStagingDir(root, path); err != nil {
+		if previous != "" {
+			os.Rename(previous, path)
+		}
+
+		return "", err
+	}
+
+	if previous != "" {
+		os.RemoveAll(previous)
+	}
+
+	entry, err := inspectCachedMod(path)
+	if err != nil {
+		return fullName, err
+	}
+
+	// Without a download URL, repairing can only report it as broken rather than re-fetch it.
+	entry.Complete = true
+	return fullName, UpdateCacheIndex(cacheDir, func(index *CacheIndex) {
+		index.Entries[fullName] = entry
+	})
+}
+
+// Returns the dir within an extracted package that holds its manifest, which is either the dir itself
+// or the only dir inside of it.
+func findPackageRoot(dir string) string {
+	if exists, _ := fileutil.ExistsInDir(dir, "manifest.json"); exists {
+		return dir
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// Runs the package at root through the validator, collecting every problem into a single error.
+func validateLocalPackage(validator PackageValidator, root string) (*localPackageManifest, error) {
+	var errBuilder strings.Builder
+	addErrs := func(file string, errs ...error) {
+		for _, err := range errs {
+			if err != nil {
+				errBuilder.WriteString(file + ": " + err.Error() + "\n")
+			}
+		}
+	}
+
+	manifestData, err := os.ReadFile(filepath.Join(root, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("package has no manifest.json at its root:\n%v", err)
+	}
+
+	// Some checks only report that they failed, without saying why.
+	invalid := errors.New("invalid")
+
+	valid, errs, err := validator.ValidateManifest(LOCAL_NAMESPACE, manifestData)
+	if !valid && len(errs) == 0 && err == nil {
+		err = invalid
+	}
+	addErrs("manifest.json", append(errs, err)...)
+
+	if readme, err := os.ReadFile(filepath.Join(root, "README.md")); err != nil {
+		addErrs("README.md", err)
+	} else {
+		valid, errs, err := validator.ValidateReadme(readme)
+		if !valid && len(errs) == 0 && err == nil {
+			err = invalid
+		}
+		addErrs("README.md", append(errs, err)...)
+	}
+
+	if icon, err := os.ReadFile(filepath.Join(root, "icon.png")); err != nil {
+		addErrs("icon.png", err)
+	} else {
+		valid, err := validator.ValidateIcon(icon)
+		if !valid && err == nil {
+			err = invalid
+		}
+		addErrs("icon.png", err)
+	}
+
+	if errBuilder.Len() > 0 {
+		return nil, fmt.Errorf("package failed validation:\n%s", errBuilder.String())
+	}
+
+	var manifest localPackageManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %v", err)
+	}
+
+	if manifest.Name == "" || manifest.VersionNumber == "" {
+		return nil, fmt.Errorf("manifest.json must have a name and version_number")
+	}
+
+	return &manifest, nil
+}
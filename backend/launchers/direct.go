@@ -1,5 +1,30 @@
 package runners
 
-func LaunchGameDirect(id uint32, args []string) {
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 
+	gocmd "github.com/go-cmd/cmd"
+)
+
+// Starts the game executable at exePath ourselves, with the given args and extra env ("KEY=VALUE") on top of our own env.
+// The working dir is set to the dir the executable is in, as most games expect.
+//
+// Unlike store launchers, this does not wait for anything. The returned channel receives the final status once the game exits.
+func LaunchGameDirect(exePath string, args []string, env []string) (*gocmd.Cmd, <-chan gocmd.Status, error) {
+	if strings.TrimSpace(exePath) == "" {
+		return nil, nil, errors.New("cannot launch game. executable path must be non-empty")
+	}
+
+	if _, err := os.Stat(exePath); err != nil {
+		return nil, nil, err
+	}
+
+	cmd := gocmd.NewCmd(exePath, args...)
+	cmd.Dir = filepath.Dir(exePath)
+	cmd.Env = append(os.Environ(), env...)
+
+	return cmd, cmd.Start(), nil
 }
@@ -31,6 +31,10 @@ func GetBepinexPluginsPath(profileDir string) string {
 	return filepath.Join(profileDir, "BepInEx", "plugins")
 }
 
+func (ldr BepinexModLoader) GetConfigDir(profileDir string) string {
+	return filepath.Join(profileDir, "BepInEx", "config")
+}
+
 func (ldr BepinexModLoader) GenerateInstructions(profileDir string) (*LoaderInstructions, error) {
 	preloaderPath, err := GetBepinexPreloaderPath(profileDir)
 	if err != nil {
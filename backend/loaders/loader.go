@@ -88,6 +88,7 @@ type LoaderInstructions struct {
 type IModLoader interface {
 	//IsLoaderPackage(fullName string) bool
 	GetModLinkPath(profileDir string) string
+	GetConfigDir(profileDir string) string
 	GenerateInstructions(profileDir string) (*LoaderInstructions, error)
 }
 
@@ -129,6 +130,15 @@ func GetModLinkPath(loader ModLoaderType, profileDir string) (string, error) {
 	return ldr.GetModLinkPath(profileDir), nil
 }
 
+func GetConfigDir(loader ModLoaderType, profileDir string) (string, error) {
+	ldr, err := GetModLoader(loader)
+	if err != nil {
+		return "", err
+	}
+
+	return ldr.GetConfigDir(profileDir), nil
+}
+
 func IsLoaderPackage(loader ModLoaderType, fullName string) bool {
 	switch loader {
 	case BEPINEX:
@@ -16,6 +16,10 @@ func (ldr LovelyModLoader) GetModLinkPath(profileDir string) string {
 	return filepath.Join("lovely", "mods")
 }
 
+func (ldr LovelyModLoader) GetConfigDir(profileDir string) string {
+	return filepath.Join(profileDir, "config")
+}
+
 // TODO: Implement this
 func (ldr LovelyModLoader) GenerateInstructions(profileDir string) (*LoaderInstructions, error) {
 	return &LoaderInstructions{}, fmt.Errorf("instructions for loader LOVELY not yet implemented")
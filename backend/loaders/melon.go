@@ -16,6 +16,10 @@ func (ldr MelonModLoader) GetModLinkPath(profileDir string) string {
 	return filepath.Join(profileDir, "Mods")
 }
 
+func (ldr MelonModLoader) GetConfigDir(profileDir string) string {
+	return filepath.Join(profileDir, "UserData")
+}
+
 // TODO: Implement this
 func (ldr MelonModLoader) GenerateInstructions(profileDir string) (*LoaderInstructions, error) {
 	return &LoaderInstructions{}, fmt.Errorf("instructions for loader MELON not yet implemented")
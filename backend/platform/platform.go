@@ -5,6 +5,8 @@ type ModPlatform string
 const (
 	NEXUS        ModPlatform = "NexusMods"
 	THUNDERSTORE ModPlatform = "Thunderstore"
+	// Mods imported from disk rather than downloaded, such as unreleased builds being tested.
+	LOCAL ModPlatform = "Local"
 )
 
 // type GamePlatform = string
@@ -0,0 +1,347 @@
+package profile
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/loaders"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The extension of a shareable profile archive. Under the hood, this is just a regular zip.
+const PROFILE_ARCHIVE_EXT = ".m8p"
+
+// Bump this whenever the layout of a profile archive changes in a way older versions can't read.
+const PROFILE_ARCHIVE_FORMAT_VERSION = 1
+
+const archiveMetaName = "modm8.json"
+
+// Information about the profile an archive was exported from, written to modm8.json at the root of the archive.
+type ProfileArchiveMeta struct {
+	FormatVersion uint16                `json:"format_version"`
+	ProfileName   string                `json:"profile_name"`
+	GameTitle     string                `json:"game_title"`
+	Loader        loaders.ModLoaderType `json:"loader"`
+	ExportedAt    time.Time             `json:"exported_at"`
+	// Optional free-form note about why the archive was made. Snapshots store their reason here.
+	Comment string `json:"comment,omitempty"`
+}
+
+// The in-memory representation of a profile archive.
+type ProfileArchive struct {
+	Meta     ProfileArchiveMeta
+	Manifest ProfileManifest
+	// Config files keyed by their slash-separated path relative to the profile dir. Ex: "BepInEx/config/IntroTweaks.cfg"
+	Files map[string][]byte
+}
+
+// Writes the manifest and loader config dir of the given profile into a single archive at outPath.
+//
+// Mods are not included. Only their names are, via the manifest, so the archive stays small
+// and the mods can be installed from the mod cache or Thunderstore when the archive is imported.
+func ExportProfile(loader loaders.ModLoaderType, gameTitle, profileName, outPath string) error {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	files, err := ReadProfileConfigFiles(loader, gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	return WriteProfileArchive(outPath, ProfileArchive{
+		Meta: ProfileArchiveMeta{
+			FormatVersion: PROFILE_ARCHIVE_FORMAT_VERSION,
+			ProfileName:   profileName,
+			GameTitle:     gameTitle,
+			Loader:        loader,
+			ExportedAt:    time.Now().UTC(),
+		},
+		Manifest: *manifest,
+		Files:    files,
+	})
+}
+
+// Reads every file inside the loader's config dir of the given profile.
+// The keys of the returned map are slash-separated paths relative to the profile dir.
+//
+// If the config dir does not exist yet, an empty map is returned.
+func ReadProfileConfigFiles(loader loaders.ModLoaderType, gameTitle, profileName string) (map[string][]byte, error) {
+	profileDir := PathToProfile(gameTitle, profileName)
+	configDir, err := loaders.GetConfigDir(loader, profileDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	if exists, _ := fileutil.ExistsAtPath(configDir); !exists {
+		return files, nil
+	}
+
+	err = filepath.WalkDir(configDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip dirs and anything that isn't a plain file (links etc.)
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(profileDir, p)
+		if err != nil {
+			return err
+		}
+
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(relPath)] = contents
+		return nil
+	})
+
+	return files, err
+}
+
+// Like [ReadProfileConfigFiles], but reads the config dir of every loader that exists in the profile.
+// Useful when the loader of the profile isn't known.
+func ReadAllProfileConfigFiles(gameTitle, profileName string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for loader := range loaders.MOD_LOADERS {
+		loaderFiles, err := ReadProfileConfigFiles(loader, gameTitle, profileName)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(files, loaderFiles)
+	}
+
+	return files, nil
+}
+
+func WriteProfileArchive(outPath string, archive ProfileArchive) error {
+	if err := fileutil.MkDirAll(filepath.Dir(outPath)); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Clean(outPath))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+
+	metaData, err := json.MarshalIndent(archive.Meta, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	manifestData, err := json.MarshalIndent(archive.Manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeZipEntry(writer, archiveMetaName, metaData); err != nil {
+		return err
+	}
+	if err := writeZipEntry(writer, manifestName, manifestData); err != nil {
+		return err
+	}
+
+	for name, contents := range archive.Files {
+		if err := writeZipEntry(writer, name, contents); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeZipEntry(writer *zip.Writer, name string, contents []byte) error {
+	w, err := writer.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create archive entry %s: %v", name, err)
+	}
+
+	_, err = w.Write(contents)
+	return err
+}
+
+// Opens the profile archive at the given path and reads its metadata, manifest and config files into memory.
+func ReadProfileArchive(archivePath string) (*ProfileArchive, error) {
+	return readProfileArchive(archivePath, true)
+}
+
+// Like [ReadProfileArchive], but leaves the config files unread (and Files empty) for when only the metadata
+// and manifest are needed, such as listing snapshots.
+func ReadProfileArchiveSummary(archivePath string) (*ProfileArchive, error) {
+	return readProfileArchive(archivePath, false)
+}
+
+func readProfileArchive(archivePath string, withFiles bool) (*ProfileArchive, error) {
+	reader, err := zip.OpenReader(filepath.Clean(archivePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile archive: %v", err)
+	}
+	defer reader.Close()
+
+	archive := ProfileArchive{Files: make(map[string][]byte)}
+
+	var foundMeta, foundManifest bool
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || (!withFiles && f.Name != archiveMetaName && f.Name != manifestName) {
+			continue
+		}
+
+		contents, err := readZipEntry(f)
+		if err != nil {
+			return nil, err
+		}
+
+		switch f.Name {
+		case archiveMetaName:
+			if err := json.Unmarshal(contents, &archive.Meta); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", archiveMetaName, err)
+			}
+
+			foundMeta = true
+		case manifestName:
+			if err := json.Unmarshal(contents, &archive.Manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", manifestName, err)
+			}
+
+			foundManifest = true
+		default:
+			archive.Files[f.Name] = contents
+		}
+	}
+
+	if !foundMeta || !foundManifest {
+		return nil, fmt.Errorf("invalid profile archive. %s and %s must both exist", archiveMetaName, manifestName)
+	}
+
+	if archive.Meta.FormatVersion > PROFILE_ARCHIVE_FORMAT_VERSION {
+		return nil, fmt.Errorf("profile archive was made by a newer version of modm8 (format v%d)", archive.Meta.FormatVersion)
+	}
+
+	return &archive, nil
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive entry %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// Unpacks the profile archive at the given path as a new profile and installs every mod it references,
+// either by linking it from the mod cache or downloading it from Thunderstore if it isn't cached.
+//
+// If profileName is empty, the name of the profile the archive was exported from is used.
+// The archive must have been exported from the same game and the profile must not already exist.
+func ImportProfile(ctx context.Context, gameTitle, archivePath, profileName string) (*ProfileArchiveMeta, error) {
+	archive, err := ReadProfileArchive(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if archive.Meta.GameTitle != gameTitle {
+		return nil, fmt.Errorf("profile archive is for game '%s', not '%s'", archive.Meta.GameTitle, gameTitle)
+	}
+
+	if strings.TrimSpace(profileName) == "" {
+		profileName = archive.Meta.ProfileName
+	}
+
+	err = UnpackProfile(ctx, archive.Meta.Loader, gameTitle, profileName, archive.Manifest, archive.Files)
+	return &archive.Meta, err
+}
+
+// Creates a new profile from a manifest and a set of files (keyed by slash-separated path relative to the profile dir),
+// then installs and links every mod in the manifest.
+//
+// Used by every kind of profile import so they all behave the same.
+// If anything fails part way through, including ctx being cancelled, the half created profile is deleted.
+func UnpackProfile(ctx context.Context, loader loaders.ModLoaderType, gameTitle, profileName string, manifest ProfileManifest, files map[string][]byte) (err error) {
+	if exists, _ := ProfileExists(gameTitle, profileName); exists {
+		return fmt.Errorf("profile '%s' already exists", profileName)
+	}
+
+	// Only a dir this import created is ours to delete.
+	dirExisted, _ := fileutil.ExistsAtPath(PathToProfile(gameTitle, profileName))
+	defer func() {
+		if err != nil && !dirExisted {
+			DeleteProfile(gameTitle, profileName)
+		}
+	}()
+
+	// The loader pack is unpacked into the profile dir itself, so it has to come before anything else is written there.
+	if err := InstallLoaderPackage(ctx, loader, gameTitle, profileName, manifest); err != nil {
+		return err
+	}
+
+	profileDir := PathToProfile(gameTitle, profileName)
+	for name, contents := range files {
+		dest, err := safeJoin(profileDir, name)
+		if err != nil {
+			return err
+		}
+
+		if err := fileutil.MkDirAll(filepath.Dir(dest)); err != nil {
+			return err
+		}
+
+		if err := fileutil.WriteFile(dest, contents); err != nil {
+			return err
+		}
+	}
+
+	if manifest.Mods == nil {
+		manifest.Mods = NewProfileManifest().Mods
+	}
+
+	if err := SaveManifest(gameTitle, profileName, manifest); err != nil {
+		return err
+	}
+
+	return InstallProfileMods(ctx, loader, gameTitle, profileName)
+}
+
+// Joins a slash-separated relative path onto dir, refusing any path that would end up outside of it.
+func safeJoin(dir, relPath string) (string, error) {
+	if err := fileutil.CheckArchiveEntryPath(relPath); err != nil {
+		return "", err
+	}
+
+	cleaned := path.Clean("/" + relPath)
+	if cleaned == "/" {
+		return "", &fileutil.ArchiveEntryError{Entry: relPath, Reason: "empty path"}
+	}
+
+	joined := filepath.Join(dir, filepath.FromSlash(cleaned))
+	if !strings.HasPrefix(joined, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", &fileutil.ArchiveEntryError{Entry: relPath, Reason: "path points outside of the profile"}
+	}
+
+	return joined, nil
+}
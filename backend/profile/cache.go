@@ -0,0 +1,323 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Written to the global mod cache once it has been split up by game.
+	namespacedMarkerName = ".namespaced"
+	// Lists the flat mods found when the migration first ran, so a retry after a partial failure only ever
+	// touches those rather than scanning again and mistaking a game's mod cache for a mod.
+	migrationJournalName = ".migrating.json"
+	// Where mods from the old flat mod cache that no profile used end up, since we can't tell which game they're for.
+	legacyCacheDirName = ".legacy"
+	// The content-addressed store that identical files across the mod cache are hard linked to. See [DedupModCache].
+	cacheStoreDirName = ".store"
+)
+
+func PathToCacheStore() string {
+	return filepath.Join(paths.ModCacheDir(), cacheStoreDirName)
+}
+
+// Hard links identical files across every mod in the mod cache (of every game) to a single copy in the cache store.
+// Every mod keeps its own dir so profile links keep working, the files inside them just share the same storage,
+// so a mod that writes to one of its own (non-config) files changes it for every mod sharing it.
+//
+// Files in a mod cache on a different drive to the global mod cache can't be linked. They are counted as skipped
+// and each one is listed in the returned error, alongside the report of everything else.
+//
+// Refuses to run with [operations.ErrBusy] while anything else is running or downloading, as it can't trust files that are still being written.
+func DedupModCache() (*fileutil.DedupReport, error) {
+	if err := requireIdle(); err != nil {
+		return nil, err
+	}
+
+	return fileutil.DedupDirs(PathToCacheStore(), modCacheDirs(knownGames()))
+}
+
+// Fails with [operations.ErrBusy] unless no operation is running and nothing is queued for download.
+func requireIdle() error {
+	if running := operations.List(); len(running) > 0 {
+		return fmt.Errorf("%w: %s '%s' is still running", operations.ErrBusy, running[0].Kind, running[0].Name)
+	}
+
+	if status := downloader.Queue.Status(); status.Running > 0 || status.Queued > 0 {
+		return fmt.Errorf("%w: %d downloads are still queued", operations.ErrBusy, status.Running+status.Queued)
+	}
+
+	return nil
+}
+
+// Deletes abandoned partial downloads from every mod cache dir. Recent ones are kept so they can be resumed.
+// See [downloader.CleanupPartialDownloads].
+func CleanupPartialDownloads() error {
+	_, err := downloader.CleanupPartialDownloads(modCacheDirs(knownGames()), downloader.PARTIAL_MAX_AGE)
+	return err
+}
+
+// Deletes whatever was left mid-extraction in the staging dirs of every mod cache and profiles dir, such as when the app
+// closed during an install. Must only be called on startup, before anything starts installing. See [fileutil.NewStagingDir].
+func CleanupStagingDirs() error {
+	games := knownGames()
+
+	dirs := modCacheDirs(games)
+	for _, game := range games {
+		dirs = append(dirs, GameProfilesPath(game.Title))
+	}
+
+	_, err := fileutil.CleanupStagingDirs(dirs)
+	return err
+}
+
+// Older versions of modm8 kept every mod directly inside the global mod cache, which meant identically named mods
+// from different games would collide. This moves each of those mods into the mod cache of every game with a profile
+// that uses it (copying it when there's more than one) and relinks said profiles.
+//
+// Anything no profile uses is moved into a separate dir where garbage collection will pick it up. See [CollectModCache].
+// Once done, a marker is written so this only ever happens once. Until then, the mods found on the first attempt are
+// recorded in a journal, and any retry works from that instead of scanning again.
+func MigrateFlatModCache() error {
+	root := paths.ModCacheDir()
+	marker := filepath.Join(root, namespacedMarkerName)
+
+	if exists, _ := fileutil.ExistsAtPath(marker); exists {
+		return nil
+	}
+
+	if err := fileutil.MkDirAll(root); err != nil {
+		return err
+	}
+
+	games := knownGames()
+
+	names, err := flatModNames(root, games)
+	if err != nil {
+		return err
+	}
+
+	// Every mod dir directly inside the global cache that hasn't been moved yet.
+	flat := make(map[string]bool)
+	entries := []os.DirEntry{}
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(root, name))
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		flat[strings.ToLower(name)] = true
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	// Which games use each flat mod, keyed by the lower case name of the mod.
+	users := make(map[string][]knownGame)
+	for _, game := range games {
+		// Games with their own mod cache never used the global one.
+		if !strings.EqualFold(filepath.Clean(paths.GameModCacheDir(game.Title)), filepath.Clean(paths.DefaultGameModCacheDir(game.Title))) {
+			continue
+		}
+
+		for _, verFullName := range gameModNames(game) {
+			key := strings.ToLower(verFullName)
+			if flat[key] {
+				users[key] = append(users[key], game)
+			}
+		}
+	}
+
+	var errBuilder strings.Builder
+	for _, entry := range entries {
+		key := strings.ToLower(entry.Name())
+		if !flat[key] {
+			continue
+		}
+
+		src := filepath.Join(root, entry.Name())
+		gameUsers := users[key]
+
+		if len(gameUsers) == 0 {
+			if err := fileutil.MoveDir(src, filepath.Join(root, legacyCacheDirName, entry.Name())); err != nil {
+				errBuilder.WriteString(err.Error() + "\n")
+			}
+
+			continue
+		}
+
+		for i, game := range gameUsers {
+			dest := filepath.Join(paths.GameModCacheDir(game.Title), entry.Name())
+			if exists, _ := fileutil.ExistsAtPath(dest); exists {
+				continue
+			}
+
+			// The last game to use it gets the original, the rest get a copy.
+			if i == len(gameUsers)-1 {
+				err = fileutil.MoveDir(src, dest)
+			} else {
+				err = fileutil.CopyDir(src, dest)
+			}
+
+			if err != nil {
+				errBuilder.WriteString(err.Error() + "\n")
+			}
+		}
+
+		// Every game already had its own copy, so the original is no longer needed by anyone.
+		if exists, _ := fileutil.ExistsAtPath(src); exists && errBuilder.Len() == 0 {
+			if err := fileutil.MoveDir(src, filepath.Join(root, legacyCacheDirName, entry.Name())); err != nil {
+				errBuilder.WriteString(err.Error() + "\n")
+			}
+		}
+	}
+
+	for _, game := range games {
+		if err := relinkFlatMods(game, root); err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+		}
+	}
+
+	if errBuilder.Len() > 0 {
+		return fmt.Errorf("errors occurred migrating mod cache:\n%s", errBuilder.String())
+	}
+
+	if err := fileutil.WriteFile(marker, []byte{}); err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(root, migrationJournalName))
+}
+
+// Returns the name of every mod in the flat mod cache at root, from the journal if a previous migration was interrupted,
+// otherwise by scanning root and recording what was found in a new journal.
+func flatModNames(root string, games map[string]knownGame) ([]string, error) {
+	journal := filepath.Join(root, migrationJournalName)
+
+	if contents, err := fileutil.ReadFile(journal); err == nil {
+		var names []string
+		if err := json.Unmarshal(contents, &names); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", migrationJournalName, err)
+		}
+
+		return names, nil
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		key := strings.ToLower(entry.Name())
+		if _, isGame := games[key]; isGame || !entry.IsDir() || strings.HasPrefix(key, ".") {
+			continue
+		}
+
+		if isFlatMod(filepath.Join(root, entry.Name())) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	data, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+
+	return names, fileutil.WriteFile(journal, data)
+}
+
+// Tells a mod left in the flat mod cache apart from the mod cache of a game, which exists without the game's own dir
+// if nothing but mods have been installed for it. Only a dir named like a versioned mod, with no cache index and
+// no mods of its own inside of it, counts as a mod.
+func isFlatMod(dir string) bool {
+	if !isVersionedModName(filepath.Base(dir)) {
+		return false
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(installing.PathToCacheIndex(dir)); exists {
+		return false
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() && isVersionedModName(entry.Name()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Reports whether the given name is the full name of a mod including its version. Ex: "Owen3H-IntroTweaks-1.5.0"
+func isVersionedModName(name string) bool {
+	return len(strings.Split(name, "-")) == 3
+}
+
+// Returns the name of every mod used by any profile of the given game.
+func gameModNames(game knownGame) []string {
+	var names []string
+
+	manifestDirs, _ := GetManifestDirs(filepath.Join(game.Dir, "Profiles"))
+	for _, dir := range manifestDirs {
+		manifest, err := GetManifestAtPath(filepath.Join(dir, manifestName))
+		if err != nil {
+			continue
+		}
+
+		for _, mods := range manifest.Mods {
+			names = append(names, mods...)
+		}
+	}
+
+	return names
+}
+
+// Points every link in the profiles of the given game that leads directly into the flat mod cache at root
+// to the same mod in the game's own mod cache, as long as it has been moved there.
+func relinkFlatMods(game knownGame, root string) error {
+	cacheDir := paths.GameModCacheDir(game.Title)
+
+	var errBuilder strings.Builder
+	filepath.WalkDir(filepath.Join(game.Dir, "Profiles"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || !fileutil.IsDirLink(path) {
+			return nil
+		}
+
+		linkSource, err := fileutil.ReadDirLink(path)
+		if err != nil || filepath.Clean(filepath.Dir(linkSource)) != filepath.Clean(root) {
+			return skipLinkedDir(entry)
+		}
+
+		newSource := filepath.Join(cacheDir, filepath.Base(linkSource))
+		if exists, _ := fileutil.ExistsAtPath(newSource); !exists {
+			return skipLinkedDir(entry)
+		}
+
+		mode := fileutil.DirLinkMode(path)
+		if err := fileutil.UnlinkDir(path); err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+			return skipLinkedDir(entry)
+		}
+
+		if err := fileutil.LinkDirWithMode(path, newSource, mode); err != nil {
+			errBuilder.WriteString(fmt.Sprintf("failed to relink %s: %v\n", path, err))
+		}
+
+		return skipLinkedDir(entry)
+	})
+
+	if errBuilder.Len() > 0 {
+		return fmt.Errorf("%s", errBuilder.String())
+	}
+
+	return nil
+}
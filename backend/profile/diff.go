@@ -0,0 +1,136 @@
+package profile
+
+import (
+	"modm8/backend/platform"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+type ModChange struct {
+	Platform platform.ModPlatform `json:"platform"`
+	// The full name of the mod without its version. Ex: "Owen3H-IntroTweaks"
+	FullName    string `json:"full_name"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"`
+	// Only used by EnabledChanged. Whether the mod is enabled in the profile being compared to.
+	Enabled bool `json:"enabled"`
+}
+
+// The differences between two manifests, from the perspective of going from the first to the second.
+type ManifestDiff struct {
+	Added          []ModChange `json:"added"`
+	Removed        []ModChange `json:"removed"`
+	Upgraded       []ModChange `json:"upgraded"`
+	Downgraded     []ModChange `json:"downgraded"`
+	EnabledChanged []ModChange `json:"enabled_changed"`
+}
+
+func (diff ManifestDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Upgraded) == 0 &&
+		len(diff.Downgraded) == 0 && len(diff.EnabledChanged) == 0
+}
+
+// Compares two manifests mod by mod. Mods are matched by platform and full name (without version),
+// so a version change shows up as an upgrade or downgrade rather than a removal and an addition.
+func DiffManifests(from, to ProfileManifest) ManifestDiff {
+	diff := ManifestDiff{
+		Added:          []ModChange{},
+		Removed:        []ModChange{},
+		Upgraded:       []ModChange{},
+		Downgraded:     []ModChange{},
+		EnabledChanged: []ModChange{},
+	}
+
+	for _, plat := range manifestPlatforms(from, to) {
+		fromMods := modVersions(from.Mods[plat])
+		toMods := modVersions(to.Mods[plat])
+
+		for fullName, fromVer := range fromMods {
+			toVer, ok := toMods[fullName]
+			if !ok {
+				diff.Removed = append(diff.Removed, ModChange{Platform: plat, FullName: fullName, FromVersion: fromVer})
+				continue
+			}
+
+			change := ModChange{Platform: plat, FullName: fullName, FromVersion: fromVer, ToVersion: toVer}
+			if cmp := CompareModVersions(fromVer, toVer); cmp < 0 {
+				diff.Upgraded = append(diff.Upgraded, change)
+			} else if cmp > 0 {
+				diff.Downgraded = append(diff.Downgraded, change)
+			}
+
+			fromEnabled := from.IsModEnabled(plat, joinModVersion(fullName, fromVer))
+			toEnabled := to.IsModEnabled(plat, joinModVersion(fullName, toVer))
+			if fromEnabled != toEnabled {
+				change.Enabled = toEnabled
+				diff.EnabledChanged = append(diff.EnabledChanged, change)
+			}
+		}
+
+		for fullName, toVer := range toMods {
+			if _, ok := fromMods[fullName]; !ok {
+				diff.Added = append(diff.Added, ModChange{Platform: plat, FullName: fullName, ToVersion: toVer})
+			}
+		}
+	}
+
+	for _, changes := range [][]ModChange{diff.Added, diff.Removed, diff.Upgraded, diff.Downgraded, diff.EnabledChanged} {
+		slices.SortFunc(changes, func(a, b ModChange) int {
+			return strings.Compare(a.FullName, b.FullName)
+		})
+	}
+
+	return diff
+}
+
+// Compares two mod versions, returning -1 if a is older than b, 1 if a is newer and 0 if they are the same.
+// Versions that aren't valid semver are compared as plain strings.
+func CompareModVersions(a, b string) int {
+	verA, errA := semver.NewVersion(a)
+	verB, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+
+	return verA.Compare(verB)
+}
+
+// Maps the full name (without version) of every mod in the list to its version.
+func modVersions(verFullNames []string) map[string]string {
+	versions := make(map[string]string, len(verFullNames))
+	for _, verFullName := range verFullNames {
+		mod, err := NewProfileMod(verFullName)
+		if err != nil {
+			versions[verFullName] = ""
+			continue
+		}
+
+		versions[mod.FullName()] = mod.Version
+	}
+
+	return versions
+}
+
+func joinModVersion(fullName, version string) string {
+	if version == "" {
+		return fullName
+	}
+
+	return fullName + "-" + version
+}
+
+func manifestPlatforms(manifests ...ProfileManifest) []platform.ModPlatform {
+	var plats []platform.ModPlatform
+	for _, manifest := range manifests {
+		for plat := range manifest.Mods {
+			if !slices.Contains(plats, plat) {
+				plats = append(plats, plat)
+			}
+		}
+	}
+
+	slices.Sort(plats)
+	return plats
+}
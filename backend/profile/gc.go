@@ -0,0 +1,296 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Decides which unreferenced mods in the mod cache get collected. Every enabled policy must agree for a mod to be collected.
+type CacheGCOptions struct {
+	// Only report what would be collected without deleting anything.
+	DryRun bool `json:"dry_run"`
+	// Only collect mods that were cached at least this many days ago. 0 disables this policy.
+	OlderThanDays uint16 `json:"older_than_days"`
+	// Always keep this many of the latest cached versions of each mod, even when unreferenced. 0 disables this policy.
+	KeepLatest uint16 `json:"keep_latest"`
+}
+
+type CacheEntry struct {
+	VerFullName string    `json:"ver_full_name"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	CachedAt    time.Time `json:"cached_at"`
+}
+
+type CacheGCReport struct {
+	DryRun bool `json:"dry_run"`
+	// How many cached mods are used by at least one profile.
+	Referenced int `json:"referenced"`
+	// Unreferenced mods that were collected, or would be on a dry run.
+	Collected []CacheEntry `json:"collected"`
+	// Unreferenced mods left alone because of the policies in [CacheGCOptions].
+	Kept []CacheEntry `json:"kept"`
+	// Unreferenced mods left alone because a running process has something inside them open.
+	InUse []CacheEntry `json:"in_use"`
+	// The total size of every unreferenced mod, collected or not.
+	UnreferencedBytes int64 `json:"unreferenced_bytes"`
+	// The total size of the collected mods.
+	FreedBytes int64 `json:"freed_bytes"`
+}
+
+// Scans the profiles of every game to find which mods in the mod cache are no longer used by any of them,
+// then deletes those the policies in opts allow. Nothing is deleted on a dry run.
+//
+// Any mod with files opened by a running process (a game that is still running, for example) is never deleted.
+// Snapshots do not count as references, restoring one will re-download anything that has been collected since.
+func CollectModCache(opts CacheGCOptions) (*CacheGCReport, error) {
+	report := &CacheGCReport{
+		DryRun:    opts.DryRun,
+		Collected: []CacheEntry{},
+		Kept:      []CacheEntry{},
+		InUse:     []CacheEntry{},
+	}
+
+	games := knownGames()
+	cacheDirs := modCacheDirs(games)
+
+	referenced, err := referencedCachePaths(games)
+	if err != nil {
+		return nil, err
+	}
+
+	// A dry run can still report what's in use where possible, but deleting anything without knowing is off the table.
+	checker, err := fileutil.NewOpenFileChecker()
+	if err != nil && !opts.DryRun {
+		return nil, fmt.Errorf("refusing to collect mod cache: %v", err)
+	}
+
+	var errBuilder strings.Builder
+	for _, cacheDir := range cacheDirs {
+		entries, err := cacheEntries(cacheDir)
+		if err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+			continue
+		}
+
+		kept := latestVersions(entries, opts.KeepLatest)
+
+		for _, entry := range entries {
+			if referenced[strings.ToLower(entry.Path)] {
+				report.Referenced++
+				continue
+			}
+
+			report.UnreferencedBytes += entry.Size
+
+			tooNew := opts.OlderThanDays > 0 && time.Since(entry.CachedAt) < time.Duration(opts.OlderThanDays)*24*time.Hour
+			if tooNew || kept[entry.Path] {
+				report.Kept = append(report.Kept, entry)
+				continue
+			}
+
+			if checker != nil && checker.InUse(entry.Path) {
+				report.InUse = append(report.InUse, entry)
+				continue
+			}
+
+			if opts.DryRun {
+				report.Collected = append(report.Collected, entry)
+				report.FreedBytes += entry.Size
+				continue
+			}
+
+			if err := os.RemoveAll(entry.Path); err != nil {
+				errBuilder.WriteString(fmt.Sprintf("failed to delete %s: %v\n", entry.VerFullName, err))
+				continue
+			}
+
+			installing.RemoveFromCacheIndex(cacheDir, entry.VerFullName)
+
+			report.Collected = append(report.Collected, entry)
+			report.FreedBytes += entry.Size
+		}
+	}
+
+	// Anything only the collected mods were using is no longer needed in the store either.
+	if !opts.DryRun {
+		if _, err := fileutil.PruneStore(PathToCacheStore()); err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+		}
+	}
+
+	if errBuilder.Len() > 0 {
+		return report, fmt.Errorf("errors occurred collecting mod cache:\n%s", errBuilder.String())
+	}
+
+	return report, nil
+}
+
+// Returns the lower case path of every cached mod used by a profile of any of the given games.
+// Links are counted as well as manifests, so that a mod is never pulled out from under a profile that still links it.
+func referencedCachePaths(games map[string]knownGame) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	for _, game := range games {
+		cacheDir := paths.GameModCacheDir(game.Title)
+		profilesDir := filepath.Join(game.Dir, "Profiles")
+
+		if exists, _ := fileutil.ExistsAtPath(profilesDir); !exists {
+			continue
+		}
+
+		manifestDirs, err := GetManifestDirs(profilesDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range manifestDirs {
+			manifest, err := GetManifestAtPath(filepath.Join(dir, manifestName))
+			if err != nil {
+				// Can't tell what this profile uses, so collecting anything could break it.
+				return nil, fmt.Errorf("cannot read manifest of profile %s: %v", filepath.Base(dir), err)
+			}
+
+			for _, mods := range manifest.Mods {
+				for _, verFullName := range mods {
+					referenced[strings.ToLower(filepath.Join(cacheDir, verFullName))] = true
+				}
+			}
+		}
+
+		err = filepath.WalkDir(profilesDir, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || !fileutil.IsDirLink(path) {
+				return nil
+			}
+
+			if linkSource, err := fileutil.ReadDirLink(path); err == nil {
+				referenced[strings.ToLower(filepath.Clean(linkSource))] = true
+			}
+
+			return skipLinkedDir(entry)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return referenced, nil
+}
+
+// Returns the mod cache dir of every known game, along with every other game dir inside the global mod cache
+// (left behind by games that no longer have profiles) and the dir holding mods that couldn't be sorted into a game.
+func modCacheDirs(games map[string]knownGame) []string {
+	cacheDirs := []string{filepath.Join(paths.ModCacheDir(), legacyCacheDirName)}
+	for _, game := range games {
+		cacheDirs = append(cacheDirs, filepath.Clean(paths.GameModCacheDir(game.Title)))
+	}
+
+	if entries, err := os.ReadDir(paths.ModCacheDir()); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				cacheDirs = append(cacheDirs, filepath.Join(paths.ModCacheDir(), entry.Name()))
+			}
+		}
+	}
+
+	// Compared ignoring case, as the dirs of known games may be cased differently on case-insensitive file systems.
+	slices.SortFunc(cacheDirs, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+
+	return slices.CompactFunc(cacheDirs, strings.EqualFold)
+}
+
+// Returns every mod in the given cache dir. Anything hidden is skipped as it isn't a mod.
+//
+// When each mod was cached comes from the cache index, as the mtime of its dir changes whenever anything inside is renamed
+// (such as by deduplication). Mods the index doesn't know about fall back to the mtime.
+func cacheEntries(cacheDir string) ([]CacheEntry, error) {
+	dirEntries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []CacheEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Best effort, as every mod still has its mtime to go by.
+	index, _ := installing.GetCacheIndex(cacheDir)
+
+	entries := []CacheEntry{}
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() || strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(cacheDir, dirEntry.Name())
+		size, err := fileutil.DirSize(path)
+		if err != nil {
+			return nil, err
+		}
+
+		cachedAt := info.ModTime()
+		if index != nil {
+			if indexed, ok := index.Entries[dirEntry.Name()]; ok && !indexed.CachedAt.IsZero() {
+				cachedAt = indexed.CachedAt
+			}
+		}
+
+		entries = append(entries, CacheEntry{
+			VerFullName: dirEntry.Name(),
+			Path:        path,
+			Size:        size,
+			CachedAt:    cachedAt,
+		})
+	}
+
+	return entries, nil
+}
+
+// Returns the paths of the `count` latest versions of each mod in entries. A count of 0 returns nothing.
+func latestVersions(entries []CacheEntry, count uint16) map[string]bool {
+	latest := make(map[string]bool)
+	if count == 0 {
+		return latest
+	}
+
+	byMod := make(map[string][]ProfileMod)
+	entryPaths := make(map[string]string)
+
+	for _, entry := range entries {
+		mod, err := NewProfileMod(entry.VerFullName)
+		if err != nil {
+			continue
+		}
+
+		key := strings.ToLower(mod.FullName())
+		byMod[key] = append(byMod[key], mod)
+		entryPaths[strings.ToLower(mod.VerFullName())] = entry.Path
+	}
+
+	for _, mods := range byMod {
+		slices.SortFunc(mods, func(a, b ProfileMod) int {
+			return CompareModVersions(b.Version, a.Version)
+		})
+
+		for i := 0; i < len(mods) && i < int(count); i++ {
+			latest[entryPaths[strings.ToLower(mods[i].VerFullName())]] = true
+		}
+	}
+
+	return latest
+}
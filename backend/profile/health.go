@@ -0,0 +1,160 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/loaders"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type HealthIssueCategory string
+
+const (
+	// A link exists in the profile, but the mod cache folder it points to is gone.
+	HEALTH_ISSUE_BROKEN_LINK HealthIssueCategory = "BROKEN_LINK"
+	// The manifest lists an enabled mod, but there is no link to it in the profile.
+	HEALTH_ISSUE_MISSING_LINK HealthIssueCategory = "MISSING_LINK"
+	// A link exists in the profile for a mod that the manifest doesn't list (or has disabled).
+	HEALTH_ISSUE_ORPHAN_LINK HealthIssueCategory = "ORPHAN_LINK"
+	// The manifest lists a mod that doesn't exist in the mod cache.
+	HEALTH_ISSUE_NOT_CACHED HealthIssueCategory = "NOT_CACHED"
+)
+
+type HealthIssue struct {
+	Category    HealthIssueCategory `json:"category"`
+	VerFullName string              `json:"ver_full_name"`
+	// The link or cache path the issue was found at.
+	Path string `json:"path"`
+}
+
+// Cross-checks the manifest of a profile against the links under the loader's mod link path and the mod cache,
+// returning every inconsistency found. An empty slice means the profile is healthy.
+//
+// Loader packages are ignored since they live in the profile itself rather than the mod cache,
+// as are links that point anywhere but the mod cache (such as those made by a dev watch).
+func CheckProfileHealth(loader loaders.ModLoaderType, gameTitle, profileName string) ([]HealthIssue, error) {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	linkDir, err := loaders.GetModLinkPath(loader, PathToProfile(gameTitle, profileName))
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir := paths.GameModCacheDir(gameTitle)
+	issues := []HealthIssue{}
+
+	// Enabled mods keyed by lower case name, so links can be matched regardless of case.
+	enabled := make(map[string]string)
+	for _, plat := range cachedModPlatforms {
+		for _, verFullName := range manifest.Mods[plat] {
+			if loaders.IsLoaderPackage(loader, verFullName) {
+				continue
+			}
+
+			cachePath := PathToCachedMod(gameTitle, verFullName)
+			if exists, _ := fileutil.ExistsAtPath(cachePath); !exists {
+				issues = append(issues, HealthIssue{Category: HEALTH_ISSUE_NOT_CACHED, VerFullName: verFullName, Path: cachePath})
+			}
+
+			if manifest.IsModEnabled(plat, verFullName) {
+				enabled[strings.ToLower(verFullName)] = verFullName
+			}
+		}
+	}
+
+	linked := make(map[string]bool)
+
+	entries, err := os.ReadDir(linkDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		linkPath := filepath.Join(linkDir, entry.Name())
+
+		// Anything that isn't a link into the mod cache was put there by hand, by the loader or by a dev watch, so it isn't ours to judge.
+		if !isModCacheLink(linkPath, cacheDir) {
+			continue
+		}
+
+		name := entry.Name()
+		if _, ok := enabled[strings.ToLower(name)]; !ok {
+			issues = append(issues, HealthIssue{Category: HEALTH_ISSUE_ORPHAN_LINK, VerFullName: name, Path: linkPath})
+			continue
+		}
+
+		linked[strings.ToLower(name)] = true
+
+		if exists, _ := fileutil.ExistsAtPath(linkPath); !exists {
+			issues = append(issues, HealthIssue{Category: HEALTH_ISSUE_BROKEN_LINK, VerFullName: name, Path: linkPath})
+		}
+	}
+
+	for lowerName, verFullName := range enabled {
+		if !linked[lowerName] {
+			issues = append(issues, HealthIssue{
+				Category:    HEALTH_ISSUE_MISSING_LINK,
+				VerFullName: verFullName,
+				Path:        filepath.Join(linkDir, verFullName),
+			})
+		}
+	}
+
+	return issues, nil
+}
+
+// Whether the given path is a link to somewhere inside the mod cache, whether or not its target still exists.
+func isModCacheLink(path, cacheDir string) bool {
+	if !fileutil.IsDirLink(path) {
+		return false
+	}
+
+	source, err := fileutil.ReadDirLink(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(filepath.Clean(cacheDir), filepath.Clean(source))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Fixes every issue found by [CheckProfileHealth]. Orphaned links are pruned, broken links are removed,
+// missing mods are re-downloaded into the mod cache and then every enabled mod is relinked.
+//
+// Returns the issues that still remain afterwards, if any.
+func RepairProfile(ctx context.Context, loader loaders.ModLoaderType, gameTitle, profileName string) ([]HealthIssue, error) {
+	issues, err := CheckProfileHealth(loader, gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issue := range issues {
+		switch issue.Category {
+		case HEALTH_ISSUE_ORPHAN_LINK, HEALTH_ISSUE_BROKEN_LINK:
+			if err := fileutil.UnlinkDir(issue.Path); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove link %s: %v", issue.Path, err)
+			}
+		}
+	}
+
+	// Re-downloads anything missing from the cache and links everything that isn't linked yet.
+	installErr := InstallProfileMods(ctx, loader, gameTitle, profileName)
+
+	remaining, err := CheckProfileHealth(loader, gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(remaining) > 0 && installErr != nil {
+		return remaining, installErr
+	}
+
+	return remaining, nil
+}
@@ -0,0 +1,168 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+)
+
+// Makes sure every Thunderstore mod in the profile's manifest exists in the mod cache (downloading it if it doesn't),
+// then links it into the profile. Mods which are already linked or are disabled are left alone.
+//
+// Local mods are linked the same way, but can only be reported as missing if they aren't cached, as there is nowhere to download them from.
+//
+// If the profile has a lockfile, each download must match the archive hash it was locked to.
+//
+// Errors are accumulated so that one bad mod doesn't prevent the rest from being installed.
+// No snapshot is taken first, as the manifest and configs are never changed, only brought in line with what the manifest says.
+func InstallProfileMods(ctx context.Context, loader loaders.ModLoaderType, gameTitle, profileName string) error {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	// Not every profile is locked, in which case there is nothing to check downloads against.
+	lock, _ := GetLockfile(gameTitle, profileName)
+
+	var errs []error
+	for _, plat := range cachedModPlatforms {
+		for _, verFullName := range manifest.Mods[plat] {
+			// Whatever has been installed so far is kept, the rest can be installed later.
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Loader packages live in the profile itself and are handled by InstallLoaderPackage.
+			if loaders.IsLoaderPackage(loader, verFullName) {
+				continue
+			}
+
+			var expectedSHA256 string
+			if lock != nil {
+				if locked := lock.Get(verFullName); locked != nil {
+					expectedSHA256 = locked.ArchiveSHA256
+				}
+			}
+
+			enabled := manifest.IsModEnabled(plat, verFullName)
+			if err := installProfileMod(ctx, loader, gameTitle, profileName, verFullName, expectedSHA256, enabled); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(manifest.Mods[platform.NEXUS]) > 0 {
+		errs = append(errs, fmt.Errorf("skipped %d Nexus mods. installing them automatically is not supported yet", len(manifest.Mods[platform.NEXUS])))
+	}
+
+	// Joined rather than flattened into text, so a rejected download can still be picked out with errors.As.
+	if len(errs) > 0 {
+		return fmt.Errorf("errors occurred installing mods for profile %s:\n%w", profileName, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Installs a single mod into the mod cache and links it into the profile (if enabled), reporting progress throughout.
+func installProfileMod(ctx context.Context, loader loaders.ModLoaderType, gameTitle, profileName, verFullName, expectedSHA256 string, enabled bool) (err error) {
+	task, owned := downloader.TrackProgress(verFullName)
+	if owned {
+		defer func() { task.Finish(err) }()
+	}
+
+	if err := InstallCachedMod(ctx, loader, gameTitle, verFullName, expectedSHA256); err != nil {
+		return err
+	}
+
+	// Disabled mods are kept in the cache so they can be re-enabled, but are not linked.
+	if !enabled {
+		return nil
+	}
+
+	linkPath, err := PathToModLink(loader, gameTitle, profileName, verFullName)
+	if err != nil {
+		return err
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(linkPath); exists {
+		return nil
+	}
+
+	task.SetPhase(downloader.PHASE_LINK)
+	if err := LinkMod(loader, gameTitle, profileName, verFullName); err != nil {
+		return fmt.Errorf("failed to link %s: %v", verFullName, err)
+	}
+
+	return nil
+}
+
+// Downloads the given mod from Thunderstore into the mod cache of the given game, unless it has already been cached.
+// If expectedSHA256 is non-empty, the download is rejected unless its archive has that hash.
+func InstallCachedMod(ctx context.Context, loader loaders.ModLoaderType, gameTitle, verFullName, expectedSHA256 string) error {
+	if exists, _ := fileutil.ExistsAtPath(PathToCachedMod(gameTitle, verFullName)); exists {
+		return nil
+	}
+
+	if installing.IsLocalPackage(verFullName) {
+		return fmt.Errorf("local mod %s is missing from the mod cache. it must be imported again", verFullName)
+	}
+
+	mod, err := NewProfileMod(verFullName)
+	if err != nil {
+		return err
+	}
+
+	ins, err := installing.GetModInstaller(loader)
+	if err != nil {
+		return err
+	}
+
+	meta := installing.PackageInstallMeta{
+		Loader:      loader,
+		FullName:    verFullName,
+		DownloadURL: mod.ThunderstoreDownloadURL(),
+		SHA256:      expectedSHA256,
+	}
+
+	_, err = ins.Install(ctx, meta, paths.GameModCacheDir(gameTitle))
+	if err != nil {
+		return fmt.Errorf("failed to install %s: %w", verFullName, err)
+	}
+
+	return nil
+}
+
+// Installs the loader package (BepInExPack etc.) listed in the manifest into the profile dir, if there is one.
+//
+// Only BepInEx is supported for now, manifests for other loaders are skipped without error.
+func InstallLoaderPackage(ctx context.Context, loader loaders.ModLoaderType, gameTitle, profileName string, manifest ProfileManifest) error {
+	if loader != loaders.BEPINEX {
+		return nil
+	}
+
+	for _, verFullName := range manifest.Mods[platform.THUNDERSTORE] {
+		if !loaders.IsLoaderPackage(loader, verFullName) {
+			continue
+		}
+
+		mod, err := NewProfileMod(verFullName)
+		if err != nil {
+			return err
+		}
+
+		_, err = installing.InstallBepinexPack(ctx, mod.ThunderstoreDownloadURL(), PathToProfile(gameTitle, profileName))
+		if err != nil {
+			return fmt.Errorf("failed to install loader package %s: %v", verFullName, err)
+		}
+
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"os"
+	"path/filepath"
+)
+
+const launchConfigName = "proflaunch.json"
+
+// Epic's launcher has no way to pass args on to the game. See [SaveLaunchConfig].
+var ErrEpicLaunchArgs = errors.New("the epic launcher cannot pass launch args. set the loader args to none and leave the game args empty, or use the direct launcher instead")
+
+type LauncherType string
+
+const (
+	LAUNCHER_STEAM  LauncherType = "steam"
+	LAUNCHER_EPIC   LauncherType = "epic"
+	LAUNCHER_DIRECT LauncherType = "direct" // Runs the game executable ourselves rather than asking a store launcher to.
+)
+
+// How a profile should be launched. Stored alongside the manifest of each profile.
+type ProfileLaunchConfig struct {
+	Launcher LauncherType `json:"launcher"`
+	// Extra args passed to the game after the loader args.
+	GameArgs []string `json:"game_args"`
+	// Extra environment variables for the game process.
+	// Only guaranteed to reach the game when launched directly, as store launchers start the game themselves.
+	Env map[string]string `json:"env"`
+	// When set, these are used instead of the args generated by the loader. See [loaders.LoaderInstructions].
+	LoaderArgs *[]string `json:"loader_args"`
+}
+
+func NewProfileLaunchConfig() ProfileLaunchConfig {
+	return ProfileLaunchConfig{
+		Launcher: LAUNCHER_STEAM,
+		GameArgs: []string{},
+		Env:      map[string]string{},
+	}
+}
+
+// Returns the env of this config in "KEY=VALUE" form, ready to be appended to a process env.
+func (cfg ProfileLaunchConfig) EnvList() []string {
+	env := make([]string, 0, len(cfg.Env))
+	for key, value := range cfg.Env {
+		env = append(env, key+"="+value)
+	}
+
+	return env
+}
+
+func PathToLaunchConfig(gameTitle, profileName string) string {
+	return filepath.Join(PathToProfile(gameTitle, profileName), launchConfigName)
+}
+
+// Returns the launch config of the given profile, or the default config if one hasn't been saved yet.
+func GetLaunchConfig(gameTitle, profileName string) (*ProfileLaunchConfig, error) {
+	cfg := NewProfileLaunchConfig()
+
+	contents, err := fileutil.ReadFile(PathToLaunchConfig(gameTitle, profileName))
+	if os.IsNotExist(err) {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", launchConfigName, err)
+	}
+
+	return &cfg, nil
+}
+
+// Saves the launch config of the given profile.
+//
+// A config using [LAUNCHER_EPIC] is refused with [ErrEpicLaunchArgs] unless it would launch with no args at all, as Epic can't pass them on.
+// That means overriding the loader args with none, so the loader is only enabled by its own config (such as BepInEx's doorstop_config.ini).
+func SaveLaunchConfig(gameTitle, profileName string, cfg ProfileLaunchConfig) error {
+	switch cfg.Launcher {
+	case LAUNCHER_STEAM, LAUNCHER_DIRECT:
+	case LAUNCHER_EPIC:
+		if cfg.LoaderArgs == nil || len(*cfg.LoaderArgs) > 0 || len(cfg.GameArgs) > 0 {
+			return ErrEpicLaunchArgs
+		}
+	default:
+		return fmt.Errorf("unknown launcher: %s", cfg.Launcher)
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(PathToLaunchConfig(gameTitle, profileName), data)
+}
@@ -0,0 +1,174 @@
+package profile
+
+import (
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/loaders"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the path where the given mod is (or would be) linked inside a profile.
+func PathToModLink(loader loaders.ModLoaderType, gameTitle, profileName, modFullName string) (string, error) {
+	profileModsDir, err := loaders.GetModLinkPath(loader, PathToProfile(gameTitle, profileName))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(profileModsDir, modFullName), nil
+}
+
+// Returns the path to the given mod in the mod cache of the given game.
+func PathToCachedMod(gameTitle, modFullName string) string {
+	return filepath.Join(paths.GameModCacheDir(gameTitle), modFullName)
+}
+
+// Returns the mode mods are linked into the given profile with.
+//
+// The first time this is called for a profile, the mode is taken from any mods already linked into it, otherwise
+// the preferred mode from the settings, probing the file system when that is auto. Whichever is chosen gets recorded
+// in the profile's metadata so every mod in the profile is linked the same way from then on.
+func ProfileLinkMode(loader loaders.ModLoaderType, gameTitle, profileName string) (fileutil.LinkMode, error) {
+	linkDir, err := loaders.GetModLinkPath(loader, PathToProfile(gameTitle, profileName))
+	if err != nil {
+		return "", err
+	}
+
+	decide := func() fileutil.LinkMode {
+		mode := existingLinkMode(linkDir)
+		if mode == "" {
+			mode = fileutil.PreferredLinkMode()
+		}
+		if mode == fileutil.LINK_MODE_AUTO {
+			mode = fileutil.ProbeLinkMode(linkDir, paths.GameModCacheDir(gameTitle))
+		}
+
+		return mode
+	}
+
+	var mode fileutil.LinkMode
+	err = UpdateProfileMeta(gameTitle, profileName, func(meta *ProfileMeta) error {
+		if meta.LinkMode == "" {
+			meta.LinkMode = decide()
+		}
+
+		mode = meta.LinkMode
+		return nil
+	})
+
+	// Without a manifest there is nowhere to record the mode yet, so it is decided again next time.
+	if os.IsNotExist(err) {
+		return decide(), nil
+	}
+
+	return mode, err
+}
+
+// Returns the mode of the first mod link found in the given dir, or an empty string if there are none.
+func existingLinkMode(linkDir string) fileutil.LinkMode {
+	entries, err := os.ReadDir(linkDir)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range entries {
+		if mode := fileutil.DirLinkMode(filepath.Join(linkDir, entry.Name())); mode != "" {
+			return mode
+		}
+	}
+
+	return ""
+}
+
+// Links a mod in the mod cache to the respective loader's mod path inside the given profile, using the profile's link mode.
+// The loader's mod path is created if it does not already exist.
+func LinkMod(loader loaders.ModLoaderType, gameTitle, profileName, modFullName string) error {
+	target, err := PathToModLink(loader, gameTitle, profileName, modFullName)
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.MkDirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	mode, err := ProfileLinkMode(loader, gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	return fileutil.LinkDirWithMode(target, PathToCachedMod(gameTitle, modFullName), mode)
+}
+
+// Removes the link to a mod from the given profile. The mod itself is left untouched in the mod cache.
+func UnlinkMod(loader loaders.ModLoaderType, gameTitle, profileName, modFullName string) error {
+	target, err := PathToModLink(loader, gameTitle, profileName, modFullName)
+	if err != nil {
+		return err
+	}
+
+	return fileutil.UnlinkDir(target)
+}
+
+// Relinks every mod linked into the given profile using a different link mode, and records it as the profile's mode.
+// Auto probes the file system for the best supported mode, same as when the profile was first linked.
+//
+// Useful after moving a profile somewhere its current mode is no longer supported, such as another drive.
+func SetProfileLinkMode(loader loaders.ModLoaderType, gameTitle, profileName string, mode fileutil.LinkMode) error {
+	linkDir, err := loaders.GetModLinkPath(loader, PathToProfile(gameTitle, profileName))
+	if err != nil {
+		return err
+	}
+
+	if mode == fileutil.LINK_MODE_AUTO {
+		mode = fileutil.ProbeLinkMode(linkDir, paths.GameModCacheDir(gameTitle))
+	}
+
+	entries, err := os.ReadDir(linkDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var errBuilder strings.Builder
+	for _, entry := range entries {
+		path := filepath.Join(linkDir, entry.Name())
+		if fileutil.DirLinkMode(path) == mode {
+			continue
+		}
+
+		source, err := fileutil.ReadDirLink(path)
+		if err != nil {
+			continue
+		}
+
+		if err := fileutil.UnlinkDir(path); err != nil {
+			errBuilder.WriteString(err.Error() + "\n")
+			continue
+		}
+
+		if err := fileutil.LinkDirWithMode(path, source, mode); err != nil {
+			errBuilder.WriteString(fmt.Sprintf("failed to relink %s: %v\n", entry.Name(), err))
+		}
+	}
+
+	if errBuilder.Len() > 0 {
+		return fmt.Errorf("errors occurred changing link mode:\n%s", errBuilder.String())
+	}
+
+	return UpdateProfileMeta(gameTitle, profileName, func(meta *ProfileMeta) error {
+		meta.LinkMode = mode
+		return nil
+	})
+}
+
+// Stops a walk from descending into a mod that was linked by hardlinking or copying, since it is a real dir.
+// Symlinks are never descended into anyway, and returning [filepath.SkipDir] for them would skip the rest of their parent.
+func skipLinkedDir(entry os.DirEntry) error {
+	if entry.IsDir() {
+		return filepath.SkipDir
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+	"os"
+	"strings"
+)
+
+// Platforms whose mods live in the mod cache and get linked into profiles.
+var cachedModPlatforms = []platform.ModPlatform{platform.THUNDERSTORE, platform.LOCAL}
+
+// Returns the platform a mod with the given full name belongs to in a profile manifest.
+func modPlatform(verFullName string) platform.ModPlatform {
+	if installing.IsLocalPackage(verFullName) {
+		return platform.LOCAL
+	}
+
+	return platform.THUNDERSTORE
+}
+
+// Imports a local package into the mod cache of the given game (see [installing.ImportLocalPackage]) and links it into the profile,
+// returning the full name it was imported as.
+//
+// The mod is listed under [platform.LOCAL] in the manifest, replacing any earlier import of the same package. If overrides is
+// the full name of a package without its version (Ex: "Owen3H-IntroTweaks"), every version of that package in the profile is
+// overridden too. Local imports have no author of their own, so packages by other authors that share a name are never touched.
+// Overridden mods are disabled rather than removed, so re-enabling them undoes the override.
+//
+// The link is always remade, as copied or hard linked mods would otherwise keep the previous build.
+// If anything fails, whatever was unlinked is linked again so the profile still matches its (unchanged) manifest.
+func InstallLocalMod(ctx context.Context, validator installing.PackageValidator, loader loaders.ModLoaderType, gameTitle, profileName, sourcePath, overrides string) (verFullName string, err error) {
+	if overrides != "" && len(strings.Split(overrides, "-")) != 2 {
+		return "", fmt.Errorf("cannot override %s. expected a full name without a version, such as Owen3H-IntroTweaks", overrides)
+	}
+
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return "", err
+	}
+
+	verFullName, err = installing.ImportLocalPackage(ctx, validator, sourcePath, paths.GameModCacheDir(gameTitle))
+	if err != nil {
+		return "", err
+	}
+
+	local, err := NewProfileMod(verFullName)
+	if err != nil {
+		return "", err
+	}
+
+	unlinked := []string{}
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for _, name := range unlinked {
+			LinkMod(loader, gameTitle, profileName, name)
+		}
+	}()
+
+	unlink := func(name string) error {
+		err := UnlinkMod(loader, gameTitle, profileName, name)
+		if err == nil {
+			unlinked = append(unlinked, name)
+		}
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, plat := range cachedModPlatforms {
+		for _, other := range manifest.Mods[plat] {
+			if strings.EqualFold(other, verFullName) || !manifest.IsModEnabled(plat, other) {
+				continue
+			}
+
+			mod, err := NewProfileMod(other)
+			if err != nil {
+				continue
+			}
+
+			earlierImport := installing.IsLocalPackage(other) && strings.EqualFold(mod.Name, local.Name)
+			if !earlierImport && (overrides == "" || !strings.EqualFold(mod.FullName(), overrides)) {
+				continue
+			}
+
+			if err := unlink(other); err != nil {
+				return "", fmt.Errorf("failed to unlink overridden mod %s: %v", other, err)
+			}
+
+			manifest.SetModEnabled(plat, other, false)
+		}
+	}
+
+	manifest.AddMod(platform.LOCAL, verFullName)
+	manifest.SetModEnabled(platform.LOCAL, verFullName, true)
+
+	if err := unlink(verFullName); err != nil {
+		return "", err
+	}
+
+	if err := LinkMod(loader, gameTitle, profileName, verFullName); err != nil {
+		return "", fmt.Errorf("failed to link %s: %v", verFullName, err)
+	}
+
+	if err := SaveManifest(gameTitle, profileName, *manifest); err != nil {
+		// The new import is linked, but the manifest doesn't know about it.
+		UnlinkMod(loader, gameTitle, profileName, verFullName)
+		return "", err
+	}
+
+	return verFullName, nil
+}
@@ -0,0 +1,246 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"modm8/backend/loaders"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const lockfileName = "proflock.json"
+
+// Pins every mod in a profile to its exact bytes, so everyone using the profile can be sure they run an identical modpack.
+type ProfileLockfile struct {
+	GeneratedAt time.Time   `json:"generated_at"`
+	Mods        []LockedMod `json:"mods"`
+}
+
+type LockedMod struct {
+	// The full name of the mod including its version. Ex: "Owen3H-IntroTweaks-1.5.0"
+	VerFullName string `json:"ver_full_name"`
+	Version     string `json:"version"`
+	// Empty for local mods, as they can't be downloaded. Only their tree hash is locked.
+	DownloadURL string `json:"download_url"`
+	// SHA-256 of the archive served at DownloadURL.
+	ArchiveSHA256 string `json:"archive_sha256"`
+	// SHA-256 of the extracted mod in the mod cache. See [fileutil.HashDir].
+	// Empty for loader packages, as they are unpacked into the profile itself rather than the cache.
+	TreeSHA256 string `json:"tree_sha256,omitempty"`
+}
+
+func (lock ProfileLockfile) Get(verFullName string) *LockedMod {
+	for i := range lock.Mods {
+		if strings.EqualFold(lock.Mods[i].VerFullName, verFullName) {
+			return &lock.Mods[i]
+		}
+	}
+
+	return nil
+}
+
+type LockMismatchReason string
+
+const (
+	LOCK_MISMATCH_NOT_CACHED LockMismatchReason = "NOT_CACHED" // Locked, but missing from the mod cache.
+	LOCK_MISMATCH_MODIFIED   LockMismatchReason = "MODIFIED"   // The cached files don't match the tree hash.
+	LOCK_MISMATCH_NOT_LOCKED LockMismatchReason = "NOT_LOCKED" // In the manifest, but not in the lockfile.
+	LOCK_MISMATCH_UNLISTED   LockMismatchReason = "UNLISTED"   // In the lockfile, but no longer in the manifest.
+)
+
+type LockMismatch struct {
+	VerFullName string             `json:"ver_full_name"`
+	Reason      LockMismatchReason `json:"reason"`
+	Expected    string             `json:"expected,omitempty"`
+	Actual      string             `json:"actual,omitempty"`
+}
+
+func PathToLockfile(gameTitle, profileName string) string {
+	return filepath.Join(PathToProfile(gameTitle, profileName), lockfileName)
+}
+
+func GetLockfile(gameTitle, profileName string) (*ProfileLockfile, error) {
+	contents, err := fileutil.ReadFile(PathToLockfile(gameTitle, profileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var lock ProfileLockfile
+	if err := json.Unmarshal(contents, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", lockfileName, err)
+	}
+
+	return &lock, nil
+}
+
+func SaveLockfile(gameTitle, profileName string, lock ProfileLockfile) error {
+	data, err := json.MarshalIndent(lock, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(PathToLockfile(gameTitle, profileName), data)
+}
+
+// Generates (and saves) a lockfile for the given profile from the Thunderstore mods in its manifest.
+//
+// Every mod must already exist in the mod cache. The archive of each mod is streamed from Thunderstore to hash it,
+// unless a previous lockfile or the cache index already knows the archive hash for the exact same version and cached files.
+func GenerateLockfile(loader loaders.ModLoaderType, gameTitle, profileName string) (*ProfileLockfile, error) {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	prevLock, _ := GetLockfile(gameTitle, profileName)
+	cacheIndex, _ := installing.GetCacheIndex(paths.GameModCacheDir(gameTitle))
+
+	lock := ProfileLockfile{
+		GeneratedAt: time.Now().UTC(),
+		Mods:        []LockedMod{},
+	}
+
+	for _, verFullName := range lockableMods(*manifest) {
+		mod, err := NewProfileMod(verFullName)
+		if err != nil {
+			return nil, err
+		}
+
+		locked := LockedMod{
+			VerFullName: mod.VerFullName(),
+			Version:     mod.Version,
+			DownloadURL: mod.ThunderstoreDownloadURL(),
+		}
+
+		if !loaders.IsLoaderPackage(loader, verFullName) {
+			locked.TreeSHA256, err = fileutil.HashDir(PathToCachedMod(gameTitle, verFullName))
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash cached files of %s: %v", verFullName, err)
+			}
+		}
+
+		// There is no archive to download for a local mod, so its files are all there is to lock.
+		if installing.IsLocalPackage(verFullName) {
+			locked.DownloadURL = ""
+			lock.Mods = append(lock.Mods, locked)
+			continue
+		}
+
+		if prevLock != nil {
+			if prev := prevLock.Get(verFullName); prev != nil && prev.TreeSHA256 == locked.TreeSHA256 && prev.ArchiveSHA256 != "" {
+				locked.ArchiveSHA256 = prev.ArchiveSHA256
+			}
+		}
+
+		// The cache index knows the archive hash of anything installed since it existed.
+		if locked.ArchiveSHA256 == "" && cacheIndex != nil {
+			if entry, ok := cacheIndex.Entries[verFullName]; ok && entry.Complete && entry.TreeSHA256 == locked.TreeSHA256 {
+				locked.ArchiveSHA256 = entry.ArchiveSHA256
+			}
+		}
+
+		if locked.ArchiveSHA256 == "" {
+			locked.ArchiveSHA256, err = HashRemoteArchive(locked.DownloadURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash archive of %s: %v", verFullName, err)
+			}
+		}
+
+		lock.Mods = append(lock.Mods, locked)
+	}
+
+	slices.SortFunc(lock.Mods, func(a, b LockedMod) int {
+		return strings.Compare(a.VerFullName, b.VerFullName)
+	})
+
+	return &lock, SaveLockfile(gameTitle, profileName, lock)
+}
+
+// Streams the archive at the given URL straight into a hash without saving it to disk.
+func HashRemoteArchive(url string) (string, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch: %s\n%v", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch: %s\nstatus: %d", url, res.StatusCode)
+	}
+
+	return fileutil.HashReader(res.Body)
+}
+
+// Compares the mod cache and manifest of the given profile against its lockfile.
+// An empty slice means everything in the profile is byte-identical to what was locked.
+func VerifyLockfile(gameTitle, profileName string) ([]LockMismatch, error) {
+	lock, err := GetLockfile(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := lockableMods(*manifest)
+
+	mismatches := []LockMismatch{}
+	for _, verFullName := range listed {
+		if lock.Get(verFullName) == nil {
+			mismatches = append(mismatches, LockMismatch{VerFullName: verFullName, Reason: LOCK_MISMATCH_NOT_LOCKED})
+		}
+	}
+
+	for _, locked := range lock.Mods {
+		if !slices.ContainsFunc(listed, func(name string) bool {
+			return strings.EqualFold(name, locked.VerFullName)
+		}) {
+			mismatches = append(mismatches, LockMismatch{VerFullName: locked.VerFullName, Reason: LOCK_MISMATCH_UNLISTED})
+			continue
+		}
+
+		if locked.TreeSHA256 == "" {
+			continue
+		}
+
+		cachedPath := PathToCachedMod(gameTitle, locked.VerFullName)
+		if exists, _ := fileutil.ExistsAtPath(cachedPath); !exists {
+			mismatches = append(mismatches, LockMismatch{VerFullName: locked.VerFullName, Reason: LOCK_MISMATCH_NOT_CACHED})
+			continue
+		}
+
+		treeHash, err := fileutil.HashDir(cachedPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash cached files of %s: %v", locked.VerFullName, err)
+		}
+
+		if treeHash != locked.TreeSHA256 {
+			mismatches = append(mismatches, LockMismatch{
+				VerFullName: locked.VerFullName,
+				Reason:      LOCK_MISMATCH_MODIFIED,
+				Expected:    locked.TreeSHA256,
+				Actual:      treeHash,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// Returns every mod in the manifest that gets locked, being those from Thunderstore and those imported locally.
+func lockableMods(manifest ProfileManifest) []string {
+	mods := []string{}
+	for _, plat := range cachedModPlatforms {
+		mods = append(mods, manifest.Mods[plat]...)
+	}
+
+	return mods
+}
@@ -3,7 +3,13 @@ package profile
 import (
 	"encoding/json"
 	"fmt"
+	"modm8/backend/app/appcore"
+	"modm8/backend/common/downloader"
 	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"modm8/backend/loaders"
 	"modm8/backend/platform"
 	"os"
 	"path/filepath"
@@ -25,10 +31,18 @@ type Profile struct {
 //
 // NOTE: All methods call regular functions so we can test said regular functions easily (since they aren't bound to the struct),
 // and know that the methods will work exactly the same. As profiles are a core feature, we should take extra caution and ensure tests pass.
-type ProfileManager struct{}
+type ProfileManager struct {
+	appSettings *appcore.AppSettings
+	validator   installing.PackageValidator
+}
+
+func NewProfileManager(appSettings *appcore.AppSettings) *ProfileManager {
+	return &ProfileManager{appSettings: appSettings}
+}
 
-func NewProfileManager() *ProfileManager {
-	return &ProfileManager{}
+// Sets the validator local mods must pass before they can be installed. See [ProfileManager.InstallLocalMod].
+func (pm *ProfileManager) SetPackageValidator(validator installing.PackageValidator) {
+	pm.validator = validator
 }
 
 func (pm *ProfileManager) GetPathToProfiles(gameTitle string) string {
@@ -56,21 +70,278 @@ func (pm *ProfileManager) NewProfile(gameTitle, profileName string) error {
 }
 
 func (pm *ProfileManager) SaveProfile(gameTitle, profileName string, prof ProfileManifest) error {
+	if err := pm.autoSnapshot(gameTitle, profileName, SNAPSHOT_REASON_UPDATE); err != nil {
+		return err
+	}
+
 	return SaveManifest(gameTitle, profileName, prof)
 }
 
+// Lists every profile along with its metadata. See [ListProfiles].
+func (pm *ProfileManager) ListProfiles(gameTitle string, opts ProfileListOptions) ([]ProfileSummary, error) {
+	return ListProfiles(gameTitle, opts)
+}
+
+func (pm *ProfileManager) GetProfileMeta(gameTitle, profileName string) (*ProfileMeta, error) {
+	return GetProfileMeta(gameTitle, profileName)
+}
+
+func (pm *ProfileManager) SetProfileDetails(gameTitle, profileName, description string, tags []string) error {
+	return SetProfileDetails(gameTitle, profileName, description, tags)
+}
+
+func (pm *ProfileManager) SetProfileIcon(gameTitle, profileName, modFullName string) error {
+	return SetProfileIcon(gameTitle, profileName, modFullName)
+}
+
+func (pm *ProfileManager) GetProfileIconPath(gameTitle, profileName string) (string, error) {
+	return GetProfileIconPath(gameTitle, profileName)
+}
+
 func (pm *ProfileManager) DeleteProfile(gameTitle, profileName string) error {
 	return DeleteProfile(gameTitle, profileName)
 }
 
+// Exports the given profile to a shareable archive at outPath. See [ExportProfile].
+func (pm *ProfileManager) ExportProfile(loader loaders.ModLoaderType, gameTitle, profileName, outPath string) error {
+	return ExportProfile(loader, gameTitle, profileName, outPath)
+}
+
+// Imports a profile archive as a new profile and installs the mods it references. See [ImportProfile].
+func (pm *ProfileManager) ImportProfile(gameTitle, archivePath, profileName string) (meta *ProfileArchiveMeta, err error) {
+	ctx, op := operations.Start(operations.OP_IMPORT, profileName)
+	defer op.Finish(&err)
+
+	// An import can pull in a whole profile's worth of mods, which shouldn't hold up the user installing something.
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_BACKGROUND)
+
+	return ImportProfile(ctx, gameTitle, archivePath, profileName)
+}
+
+// Imports an r2modman profile export (.r2z) as a new profile. See [ImportR2Profile].
+func (pm *ProfileManager) ImportR2Profile(loader loaders.ModLoaderType, gameTitle, r2zPath, profileName string) (export *R2Export, err error) {
+	ctx, op := operations.Start(operations.OP_IMPORT, profileName)
+	defer op.Finish(&err)
+
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_BACKGROUND)
+
+	return ImportR2Profile(ctx, loader, gameTitle, r2zPath, profileName)
+}
+
+// Imports a profile shared by an r2modman user via a share code. See [ImportR2ShareCode].
+func (pm *ProfileManager) ImportR2ShareCode(loader loaders.ModLoaderType, gameTitle, code, profileName string) (export *R2Export, err error) {
+	ctx, op := operations.Start(operations.OP_IMPORT, profileName)
+	defer op.Finish(&err)
+
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_BACKGROUND)
+
+	return ImportR2ShareCode(ctx, loader, gameTitle, code, profileName)
+}
+
+func (pm *ProfileManager) ExportR2Profile(loader loaders.ModLoaderType, gameTitle, profileName, outPath string) error {
+	return ExportR2Profile(loader, gameTitle, profileName, outPath)
+}
+
+func (pm *ProfileManager) ExportR2ShareCode(loader loaders.ModLoaderType, gameTitle, profileName string) (string, error) {
+	return ExportR2ShareCode(loader, gameTitle, profileName)
+}
+
+// Generates a lockfile pinning the exact bytes of every mod in the profile. See [GenerateLockfile].
+func (pm *ProfileManager) GenerateLockfile(loader loaders.ModLoaderType, gameTitle, profileName string) (*ProfileLockfile, error) {
+	return GenerateLockfile(loader, gameTitle, profileName)
+}
+
+func (pm *ProfileManager) GetLockfile(gameTitle, profileName string) (*ProfileLockfile, error) {
+	return GetLockfile(gameTitle, profileName)
+}
+
+// Compares the mod cache against the profile's lockfile. See [VerifyLockfile].
+func (pm *ProfileManager) VerifyLockfile(gameTitle, profileName string) ([]LockMismatch, error) {
+	return VerifyLockfile(gameTitle, profileName)
+}
+
+func (pm *ProfileManager) GetLaunchConfig(gameTitle, profileName string) (*ProfileLaunchConfig, error) {
+	return GetLaunchConfig(gameTitle, profileName)
+}
+
+func (pm *ProfileManager) SaveLaunchConfig(gameTitle, profileName string, cfg ProfileLaunchConfig) error {
+	return SaveLaunchConfig(gameTitle, profileName, cfg)
+}
+
+// Cross-checks the manifest, links and mod cache of a profile. See [CheckProfileHealth].
+func (pm *ProfileManager) CheckProfileHealth(loader loaders.ModLoaderType, gameTitle, profileName string) ([]HealthIssue, error) {
+	return CheckProfileHealth(loader, gameTitle, profileName)
+}
+
+// Returns how mods are linked into a profile, deciding on a mode if none has been yet. See [ProfileLinkMode].
+func (pm *ProfileManager) GetProfileLinkMode(loader loaders.ModLoaderType, gameTitle, profileName string) (fileutil.LinkMode, error) {
+	return ProfileLinkMode(loader, gameTitle, profileName)
+}
+
+// Relinks every mod in a profile using a different link mode. See [SetProfileLinkMode].
+func (pm *ProfileManager) SetProfileLinkMode(loader loaders.ModLoaderType, gameTitle, profileName string, mode fileutil.LinkMode) error {
+	return SetProfileLinkMode(loader, gameTitle, profileName, mode)
+}
+
+// Automatically fixes any health issues with a profile. See [RepairProfile].
+func (pm *ProfileManager) RepairProfile(loader loaders.ModLoaderType, gameTitle, profileName string) (issues []HealthIssue, err error) {
+	ctx, op := operations.Start(operations.OP_REPAIR, profileName)
+	defer op.Finish(&err)
+
+	// Re-downloads can wait behind anything the user is actively installing.
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_BACKGROUND)
+
+	return RepairProfile(ctx, loader, gameTitle, profileName)
+}
+
 func (pm *ProfileManager) AddModToProfile(platform platform.ModPlatform, gameTitle, profileName, verFullName string) error {
+	if err := pm.autoSnapshot(gameTitle, profileName, SNAPSHOT_REASON_INSTALL); err != nil {
+		return err
+	}
+
 	return UpdateProfileMods(MANIFEST_OP_MOD_ADD, platform, gameTitle, profileName, verFullName)
 }
 
 func (pm *ProfileManager) RemoveModFromProfile(platform platform.ModPlatform, gameTitle, profileName, verFullName string) error {
+	if err := pm.autoSnapshot(gameTitle, profileName, SNAPSHOT_REASON_REMOVE); err != nil {
+		return err
+	}
+
 	return UpdateProfileMods(MANIFEST_OP_MOD_REMOVE, platform, gameTitle, profileName, verFullName)
 }
 
+// Imports a local zip or folder and links it into the profile, overriding every version of the package named by overrides
+// (Ex: "Owen3H-IntroTweaks"), if any. See [InstallLocalMod].
+func (pm *ProfileManager) InstallLocalMod(loader loaders.ModLoaderType, gameTitle, profileName, path, overrides string) (verFullName string, err error) {
+	if pm.validator == nil {
+		return "", fmt.Errorf("cannot install local mod. no package validator has been set")
+	}
+
+	if err := pm.autoSnapshot(gameTitle, profileName, SNAPSHOT_REASON_INSTALL); err != nil {
+		return "", err
+	}
+
+	ctx, op := operations.Start(operations.OP_INSTALL, filepath.Base(path))
+	defer op.Finish(&err)
+
+	return InstallLocalMod(ctx, pm.validator, loader, gameTitle, profileName, path, overrides)
+}
+
+// Moves the profiles of every game to a new location. See [MoveGamesDir].
+func (pm *ProfileManager) MoveGamesDir(newDir string) error {
+	return MoveGamesDir(pm.appSettings, newDir)
+}
+
+// Moves the global mod cache to a new location and relinks every profile. See [MoveModCacheDir].
+func (pm *ProfileManager) MoveModCacheDir(newDir string) error {
+	return MoveModCacheDir(pm.appSettings, newDir)
+}
+
+func (pm *ProfileManager) MoveGameDir(gameTitle, newDir string) error {
+	return MoveGameDir(pm.appSettings, gameTitle, newDir)
+}
+
+func (pm *ProfileManager) MoveGameModCache(gameTitle, newDir string) error {
+	return MoveGameModCache(pm.appSettings, gameTitle, newDir)
+}
+
+// Checks the mod cache of the given game for incomplete or modified mods. See [installing.VerifyModCache].
+func (pm *ProfileManager) VerifyModCache(gameTitle string) ([]installing.CacheIssue, error) {
+	return installing.VerifyModCache(paths.GameModCacheDir(gameTitle))
+}
+
+// Re-fetches any incomplete or modified mods in the mod cache of the given game. See [installing.RepairModCache].
+func (pm *ProfileManager) RepairModCache(gameTitle string) (issues []installing.CacheIssue, err error) {
+	ctx, op := operations.Start(operations.OP_REPAIR_CACHE, gameTitle)
+	defer op.Finish(&err)
+
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_BACKGROUND)
+
+	return installing.RepairModCache(ctx, paths.GameModCacheDir(gameTitle))
+}
+
+// Hard links identical files across the mod cache to save space. See [DedupModCache].
+func (pm *ProfileManager) DedupModCache() (*fileutil.DedupReport, error) {
+	return DedupModCache()
+}
+
+// Deletes mods from the mod cache that no profile uses anymore. See [CollectModCache].
+func (pm *ProfileManager) CollectModCache(opts CacheGCOptions) (*CacheGCReport, error) {
+	return CollectModCache(opts)
+}
+
+// Takes a snapshot of the profile on demand. See [CreateSnapshot].
+func (pm *ProfileManager) CreateSnapshot(gameTitle, profileName string) (*ProfileSnapshot, error) {
+	return CreateSnapshot(gameTitle, profileName, SNAPSHOT_REASON_MANUAL, snapshotRetention(pm.appSettings))
+}
+
+func (pm *ProfileManager) GetSnapshots(gameTitle, profileName string) ([]ProfileSnapshot, error) {
+	return GetSnapshots(gameTitle, profileName)
+}
+
+func (pm *ProfileManager) DeleteSnapshot(gameTitle, profileName, id string) error {
+	return DeleteSnapshot(gameTitle, profileName, id)
+}
+
+// Rolls the profile back to the given snapshot, snapshotting it first so the restore itself can be undone. See [RestoreSnapshot].
+func (pm *ProfileManager) RestoreSnapshot(loader loaders.ModLoaderType, gameTitle, profileName, id string) (err error) {
+	// Not pruned until after restoring, as that could delete the very snapshot being restored.
+	if exists, _ := ProfileExists(gameTitle, profileName); exists {
+		if _, err := CreateSnapshot(gameTitle, profileName, SNAPSHOT_REASON_RESTORE, 0); err != nil {
+			return fmt.Errorf("failed to snapshot profile before %s: %v", SNAPSHOT_REASON_RESTORE, err)
+		}
+	}
+
+	ctx, op := operations.Start(operations.OP_RESTORE, profileName)
+	defer op.Finish(&err)
+
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_BACKGROUND)
+
+	if err := RestoreSnapshot(ctx, loader, gameTitle, profileName, id); err != nil {
+		return err
+	}
+
+	return PruneSnapshots(gameTitle, profileName, snapshotRetention(pm.appSettings))
+}
+
+func (pm *ProfileManager) autoSnapshot(gameTitle, profileName string, reason SnapshotReason) error {
+	return AutoSnapshot(pm.appSettings, gameTitle, profileName, reason)
+}
+
+// Enables or disables a mod in the profile, linking or unlinking it to match.
+func (pm *ProfileManager) SetModEnabled(loader loaders.ModLoaderType, gameTitle, profileName, verFullName string, enabled bool) error {
+	if err := pm.autoSnapshot(gameTitle, profileName, SNAPSHOT_REASON_UPDATE); err != nil {
+		return err
+	}
+
+	return SetModEnabled(loader, gameTitle, profileName, verFullName, enabled)
+}
+
+func SetModEnabled(loader loaders.ModLoaderType, gameTitle, profileName, verFullName string, enabled bool) error {
+	pman, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	plat := modPlatform(verFullName)
+	if pman.IsModEnabled(plat, verFullName) == enabled {
+		return nil
+	}
+
+	if enabled {
+		err = LinkMod(loader, gameTitle, profileName, verFullName)
+	} else {
+		err = UnlinkMod(loader, gameTitle, profileName, verFullName)
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pman.SetModEnabled(plat, verFullName, enabled)
+	return SaveManifest(gameTitle, profileName, *pman)
+}
+
 func UpdateProfileMods(op ManifestOperation, platform platform.ModPlatform, gameTitle, profileName, verFullName string) error {
 	pman, err := GetManifest(gameTitle, profileName)
 	if err != nil {
@@ -91,10 +362,7 @@ func UpdateProfileMods(op ManifestOperation, platform platform.ModPlatform, game
 }
 
 func GameProfilesPath(gameTitle string) string {
-	cacheDir, _ := os.UserConfigDir()
-	path := filepath.Join(cacheDir, "modm8", "Games", gameTitle, "Profiles")
-
-	return path
+	return filepath.Join(paths.GameDir(gameTitle), "Profiles")
 }
 
 func PathToProfile(gameTitle, profileName string) string {
@@ -173,11 +441,26 @@ func SaveManifest(gameTitle, profileName string, prof ProfileManifest) error {
 		return err
 	}
 
-	return fileutil.WriteFile(manifestPath, data)
+	if err := fileutil.WriteFile(manifestPath, data); err != nil {
+		return err
+	}
+
+	// Metadata is only informational, failing to update it shouldn't fail the save.
+	touchProfileMeta(gameTitle, profileName)
+	return nil
+}
+
+func ProfileExists(gameTitle, profileName string) (bool, error) {
+	return fileutil.ExistsAtPath(PathToManifest(gameTitle, profileName))
 }
 
+// Deletes the profile along with its snapshots, so a new profile with the same name doesn't inherit them.
 func DeleteProfile(gameTitle, profileName string) error {
-	return os.RemoveAll(PathToProfile(gameTitle, profileName))
+	if err := os.RemoveAll(PathToProfile(gameTitle, profileName)); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(PathToProfileSnapshots(gameTitle, profileName))
 }
 
 func GetManifest(gameTitle, profileName string) (*ProfileManifest, error) {
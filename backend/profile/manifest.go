@@ -14,6 +14,8 @@ const manifestName = "profinfo.json"
 type ProfileMods map[platform.ModPlatform][]string
 type ProfileManifest struct {
 	Mods ProfileMods
+	// Mods which are still part of the profile (and listed in Mods) but should not be linked/loaded.
+	Disabled ProfileMods `json:",omitempty"`
 }
 
 func NewProfileManifest() ProfileManifest {
@@ -42,9 +44,41 @@ func (manifest *ProfileManifest) RemoveMod(platform platform.ModPlatform, verFul
 	})
 
 	newLen := len(manifest.Mods[platform])
+	manifest.SetModEnabled(platform, verFullName, true)
+
 	return clampL(0, prevLen-newLen)
 }
 
+func (manifest *ProfileManifest) IsModEnabled(platform platform.ModPlatform, verFullName string) bool {
+	return !lo.ContainsBy(manifest.Disabled[platform], func(el string) bool {
+		return strings.EqualFold(el, verFullName)
+	})
+}
+
+// Marks a mod in this manifest as enabled or disabled. Disabled mods stay in the manifest, but should not be linked.
+func (manifest *ProfileManifest) SetModEnabled(platform platform.ModPlatform, verFullName string, enabled bool) {
+	if manifest.IsModEnabled(platform, verFullName) == enabled {
+		return
+	}
+
+	if !enabled {
+		if manifest.Disabled == nil {
+			manifest.Disabled = ProfileMods{}
+		}
+
+		manifest.Disabled[platform] = append(manifest.Disabled[platform], verFullName)
+		return
+	}
+
+	manifest.Disabled[platform] = lo.Filter(manifest.Disabled[platform], func(el string, idx int) bool {
+		return !strings.EqualFold(el, verFullName)
+	})
+
+	if len(manifest.Disabled[platform]) == 0 {
+		delete(manifest.Disabled, platform)
+	}
+}
+
 func clampL(min int, x int) uint {
 	if x < min {
 		x = min
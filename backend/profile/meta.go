@@ -0,0 +1,327 @@
+package profile
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"modm8/backend/common/fileutil"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metaName = "profmeta.json"
+
+// Guards read-modify-write updates to metadata, since play sessions are recorded from a separate goroutine.
+var metaMutex sync.Mutex
+
+// User facing information about a profile that isn't needed to install it, stored next to its manifest.
+type ProfileMeta struct {
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	// Full name of the mod (no version) whose icon represents this profile. Empty means the default icon.
+	Icon         string     `json:"icon"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModifiedAt   time.Time  `json:"modified_at"`
+	LastPlayedAt *time.Time `json:"last_played_at"`
+	// Total time spent in game with this profile, in seconds. Only direct launches can be timed.
+	Playtime uint64 `json:"playtime"`
+	// How mods are linked into this profile. Empty until the first mod is linked. See [ProfileLinkMode].
+	LinkMode fileutil.LinkMode `json:"link_mode"`
+}
+
+type ProfileSortField string
+
+const (
+	PROFILE_SORT_NAME        ProfileSortField = "name"
+	PROFILE_SORT_CREATED     ProfileSortField = "created"
+	PROFILE_SORT_MODIFIED    ProfileSortField = "modified"
+	PROFILE_SORT_LAST_PLAYED ProfileSortField = "last_played"
+	PROFILE_SORT_PLAYTIME    ProfileSortField = "playtime"
+	PROFILE_SORT_MOD_COUNT   ProfileSortField = "mod_count"
+)
+
+// Controls the order and contents of [ListProfiles]. The zero value lists every profile by name.
+type ProfileListOptions struct {
+	SortBy     ProfileSortField `json:"sort_by"`
+	Descending bool             `json:"descending"`
+	// Only profiles with every one of these tags are listed. Case-insensitive.
+	Tags []string `json:"tags"`
+	// Only profiles whose name or description contain this are listed. Case-insensitive.
+	Search string `json:"search"`
+}
+
+type ProfileSummary struct {
+	Name     string          `json:"name"`
+	Manifest ProfileManifest `json:"manifest"`
+	Meta     ProfileMeta     `json:"meta"`
+	ModCount int             `json:"mod_count"`
+}
+
+func PathToProfileMeta(gameTitle, profileName string) string {
+	return filepath.Join(PathToProfile(gameTitle, profileName), metaName)
+}
+
+// Returns the metadata of the given profile.
+//
+// Profiles made before metadata existed have none saved, so their times are taken from the manifest file instead.
+func GetProfileMeta(gameTitle, profileName string) (*ProfileMeta, error) {
+	contents, err := fileutil.ReadFile(PathToProfileMeta(gameTitle, profileName))
+	if os.IsNotExist(err) {
+		info, err := os.Stat(PathToManifest(gameTitle, profileName))
+		if err != nil {
+			return nil, err
+		}
+
+		return &ProfileMeta{
+			Tags:       []string{},
+			CreatedAt:  info.ModTime().UTC(),
+			ModifiedAt: info.ModTime().UTC(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta ProfileMeta
+	if err := json.Unmarshal(contents, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", metaName, err)
+	}
+
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+
+	return &meta, nil
+}
+
+func SaveProfileMeta(gameTitle, profileName string, meta ProfileMeta) error {
+	data, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(PathToProfileMeta(gameTitle, profileName), data)
+}
+
+// Loads the metadata of the given profile, passes it to fn and saves the result, all while holding the meta lock.
+func UpdateProfileMeta(gameTitle, profileName string, fn func(meta *ProfileMeta) error) error {
+	metaMutex.Lock()
+	defer metaMutex.Unlock()
+
+	meta, err := GetProfileMeta(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(meta); err != nil {
+		return err
+	}
+
+	return SaveProfileMeta(gameTitle, profileName, *meta)
+}
+
+// Sets the description and tags of a profile. Tags are trimmed and deduplicated (ignoring case).
+func SetProfileDetails(gameTitle, profileName, description string, tags []string) error {
+	cleaned := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.ContainsFunc(cleaned, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			continue
+		}
+
+		cleaned = append(cleaned, tag)
+	}
+
+	return UpdateProfileMeta(gameTitle, profileName, func(meta *ProfileMeta) error {
+		meta.Description = description
+		meta.Tags = cleaned
+		meta.ModifiedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// Sets the icon of a profile to that of one of its mods. An empty modFullName resets it to the default icon.
+func SetProfileIcon(gameTitle, profileName, modFullName string) error {
+	if modFullName != "" {
+		verFullName, err := findModInProfile(gameTitle, profileName, modFullName)
+		if err != nil {
+			return err
+		}
+
+		modFullName = verFullName[:len(modFullName)] // Keep the casing from the manifest.
+	}
+
+	return UpdateProfileMeta(gameTitle, profileName, func(meta *ProfileMeta) error {
+		meta.Icon = modFullName
+		return nil
+	})
+}
+
+// Returns the path to the icon of the mod chosen as the profile icon, or an empty string if the profile has no icon set.
+func GetProfileIconPath(gameTitle, profileName string) (string, error) {
+	meta, err := GetProfileMeta(gameTitle, profileName)
+	if err != nil || meta.Icon == "" {
+		return "", err
+	}
+
+	verFullName, err := findModInProfile(gameTitle, profileName, meta.Icon)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(PathToCachedMod(gameTitle, verFullName), "icon.png"), nil
+}
+
+// Finds the Thunderstore or local mod in the manifest of a profile that matches the given full name, returning its full name with version.
+func findModInProfile(gameTitle, profileName, modFullName string) (string, error) {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, plat := range cachedModPlatforms {
+		for _, verFullName := range manifest.Mods[plat] {
+			mod, err := NewProfileMod(verFullName)
+			if err == nil && strings.EqualFold(mod.FullName(), modFullName) {
+				return verFullName, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("mod '%s' is not part of profile '%s'", modFullName, profileName)
+}
+
+// Bumps the modified time of a profile, setting the created time too if this is the first time metadata is saved for it.
+func touchProfileMeta(gameTitle, profileName string) error {
+	metaMutex.Lock()
+	defer metaMutex.Unlock()
+
+	now := time.Now().UTC()
+
+	meta, err := GetProfileMeta(gameTitle, profileName)
+	if err != nil {
+		meta = &ProfileMeta{Tags: []string{}, CreatedAt: now}
+	}
+
+	meta.ModifiedAt = now
+	return SaveProfileMeta(gameTitle, profileName, *meta)
+}
+
+// Records that the given profile was launched at the given time.
+func MarkProfilePlayed(gameTitle, profileName string, at time.Time) error {
+	return UpdateProfileMeta(gameTitle, profileName, func(meta *ProfileMeta) error {
+		at = at.UTC()
+		meta.LastPlayedAt = &at
+		return nil
+	})
+}
+
+// Adds the length of a finished play session to the total playtime of the given profile.
+func AddProfilePlaytime(gameTitle, profileName string, played time.Duration) error {
+	if played <= 0 {
+		return nil
+	}
+
+	return UpdateProfileMeta(gameTitle, profileName, func(meta *ProfileMeta) error {
+		meta.Playtime += uint64(played.Seconds())
+		return nil
+	})
+}
+
+// Returns a summary of every profile for the given game, filtered and sorted according to opts.
+func ListProfiles(gameTitle string, opts ProfileListOptions) ([]ProfileSummary, error) {
+	profiles, err := GetProfiles(gameTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	search := strings.ToLower(strings.TrimSpace(opts.Search))
+	summaries := []ProfileSummary{}
+
+	for name, manifest := range profiles {
+		meta, err := GetProfileMeta(gameTitle, name)
+		if err != nil {
+			continue
+		}
+
+		if search != "" &&
+			!strings.Contains(strings.ToLower(name), search) &&
+			!strings.Contains(strings.ToLower(meta.Description), search) {
+			continue
+		}
+
+		if !hasAllTags(meta.Tags, opts.Tags) {
+			continue
+		}
+
+		summaries = append(summaries, ProfileSummary{
+			Name:     name,
+			Manifest: manifest,
+			Meta:     *meta,
+			ModCount: countMods(manifest),
+		})
+	}
+
+	SortProfileSummaries(summaries, opts.SortBy, opts.Descending)
+	return summaries, nil
+}
+
+// Sorts profile summaries by the given field, falling back to the name when two are equal.
+// Profiles that were never played always come last when sorting by last played.
+func SortProfileSummaries(summaries []ProfileSummary, sortBy ProfileSortField, descending bool) {
+	slices.SortFunc(summaries, func(a, b ProfileSummary) int {
+		var res int
+
+		switch sortBy {
+		case PROFILE_SORT_CREATED:
+			res = a.Meta.CreatedAt.Compare(b.Meta.CreatedAt)
+		case PROFILE_SORT_MODIFIED:
+			res = a.Meta.ModifiedAt.Compare(b.Meta.ModifiedAt)
+		case PROFILE_SORT_LAST_PLAYED:
+			if a.Meta.LastPlayedAt == nil || b.Meta.LastPlayedAt == nil {
+				if a.Meta.LastPlayedAt != b.Meta.LastPlayedAt {
+					if a.Meta.LastPlayedAt == nil {
+						return 1
+					}
+					return -1
+				}
+			} else {
+				res = a.Meta.LastPlayedAt.Compare(*b.Meta.LastPlayedAt)
+			}
+		case PROFILE_SORT_PLAYTIME:
+			res = cmp.Compare(a.Meta.Playtime, b.Meta.Playtime)
+		case PROFILE_SORT_MOD_COUNT:
+			res = cmp.Compare(a.ModCount, b.ModCount)
+		default:
+			res = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+
+		if descending {
+			res = -res
+		}
+
+		if res == 0 {
+			res = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+
+		return res
+	})
+}
+
+func hasAllTags(tags, required []string) bool {
+	for _, req := range required {
+		found := slices.ContainsFunc(tags, func(tag string) bool {
+			return strings.EqualFold(tag, strings.TrimSpace(req))
+		})
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
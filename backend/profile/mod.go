@@ -1,26 +1,45 @@
 package profile
 
-// import (
-// 	"strings"
-// )
-
-// type ProfileMod struct {
-// 	Author  string `json:"author"`
-// 	Name    string `json:"name"`
-// 	Version string `json:"version"`
-// }
-
-// func NewProfileMod(verFullName string) ProfileMod {
-// 	info := strings.Split(verFullName, "-")
-
-// 	ver := "latest"
-// 	if len(info) == 3 {
-// 		ver = info[2]
-// 	}
-
-// 	return ProfileMod{
-// 		Author:  info[0],
-// 		Name:    info[1],
-// 		Version: ver,
-// 	}
-// }
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const THUNDERSTORE_DOWNLOAD_URL = "https://thunderstore.io/package/download/"
+
+type ProfileMod struct {
+	Author  string `json:"author"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Splits a full name such as "Owen3H-IntroTweaks-1.5.0" into its author, name and version.
+// The version is required, since it is needed to find the mod in the cache and to download it from Thunderstore.
+func NewProfileMod(verFullName string) (ProfileMod, error) {
+	info := strings.Split(verFullName, "-")
+	if len(info) != 3 || slices.Contains(info, "") {
+		return ProfileMod{}, fmt.Errorf("invalid mod full name: %s. expected Author-Name-Version", verFullName)
+	}
+
+	return ProfileMod{
+		Author:  info[0],
+		Name:    info[1],
+		Version: info[2],
+	}, nil
+}
+
+// The full name of this mod without the version. Ex: "Owen3H-IntroTweaks"
+func (mod ProfileMod) FullName() string {
+	return mod.Author + "-" + mod.Name
+}
+
+// The full name of this mod including the version. Ex: "Owen3H-IntroTweaks-1.5.0"
+func (mod ProfileMod) VerFullName() string {
+	return mod.FullName() + "-" + mod.Version
+}
+
+// Builds the URL where this exact version of the mod can be downloaded from Thunderstore.
+func (mod ProfileMod) ThunderstoreDownloadURL() string {
+	return THUNDERSTORE_DOWNLOAD_URL + mod.Author + "/" + mod.Name + "/" + mod.Version + "/"
+}
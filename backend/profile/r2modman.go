@@ -0,0 +1,309 @@
+package profile
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The extension r2modman (and Thunderstore Mod Manager) give to exported profiles.
+const R2_PROFILE_EXT = ".r2z"
+
+const (
+	r2ExportName = "export.r2x"
+	// Every profile stored on the legacy profile endpoint is prefixed with this line, followed by the base64 encoded .r2z data.
+	r2ProfileDataPrefix = "#r2modman"
+
+	R2_PROFILE_GET_URL    = "https://thunderstore.io/api/experimental/legacyprofile/get/%s/"
+	R2_PROFILE_CREATE_URL = "https://thunderstore.io/api/experimental/legacyprofile/create/"
+)
+
+// Mirrors the export.r2x YAML file found at the root of an r2modman profile export.
+type R2Export struct {
+	ProfileName string        `yaml:"profileName"`
+	Mods        []R2ExportMod `yaml:"mods"`
+}
+
+type R2ExportMod struct {
+	Name    string       `yaml:"name"` // Ex: "Owen3H-IntroTweaks"
+	Version R2ModVersion `yaml:"version"`
+	Enabled bool         `yaml:"enabled"`
+}
+
+type R2ModVersion struct {
+	Major int `yaml:"major"`
+	Minor int `yaml:"minor"`
+	Patch int `yaml:"patch"`
+}
+
+func (ver R2ModVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", ver.Major, ver.Minor, ver.Patch)
+}
+
+func ParseR2ModVersion(version string) (R2ModVersion, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return R2ModVersion{}, fmt.Errorf("invalid mod version: %s", version)
+	}
+
+	nums := make([]int, 3)
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil {
+			return R2ModVersion{}, fmt.Errorf("invalid mod version: %s", version)
+		}
+
+		nums[i] = num
+	}
+
+	return R2ModVersion{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+// Converts this export into a modm8 manifest. Mods which were disabled in r2modman are kept, but marked as disabled.
+func (export R2Export) ToManifest() ProfileManifest {
+	manifest := NewProfileManifest()
+	for _, mod := range export.Mods {
+		verFullName := mod.Name + "-" + mod.Version.String()
+
+		manifest.AddMod(platform.THUNDERSTORE, verFullName)
+		manifest.SetModEnabled(platform.THUNDERSTORE, verFullName, mod.Enabled)
+	}
+
+	return manifest
+}
+
+// Converts a modm8 manifest into an r2modman export. Only Thunderstore mods are included since r2modman doesn't support anything else.
+func NewR2Export(profileName string, manifest ProfileManifest) (R2Export, error) {
+	export := R2Export{ProfileName: profileName, Mods: []R2ExportMod{}}
+	for _, verFullName := range manifest.Mods[platform.THUNDERSTORE] {
+		mod, err := NewProfileMod(verFullName)
+		if err != nil {
+			return export, err
+		}
+
+		ver, err := ParseR2ModVersion(mod.Version)
+		if err != nil {
+			return export, fmt.Errorf("cannot export %s: %v", verFullName, err)
+		}
+
+		export.Mods = append(export.Mods, R2ExportMod{
+			Name:    mod.FullName(),
+			Version: ver,
+			Enabled: manifest.IsModEnabled(platform.THUNDERSTORE, verFullName),
+		})
+	}
+
+	return export, nil
+}
+
+// Reads the data of an r2modman profile export (.r2z) and returns its export.r2x contents,
+// along with every other file in the archive keyed by its slash-separated path.
+func ReadR2Archive(data []byte) (*R2Export, map[string][]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read r2modman profile: %v", err)
+	}
+
+	var export *R2Export
+	files := make(map[string][]byte)
+
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		contents, err := readZipEntry(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if f.Name != r2ExportName {
+			files[f.Name] = contents
+			continue
+		}
+
+		export = &R2Export{}
+		if err := yaml.Unmarshal(contents, export); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %v", r2ExportName, err)
+		}
+	}
+
+	if export == nil {
+		return nil, nil, fmt.Errorf("invalid r2modman profile. %s not found", r2ExportName)
+	}
+
+	return export, files, nil
+}
+
+// Creates the data of an r2modman profile export (.r2z) from an export and its config files.
+func WriteR2Archive(export R2Export, files map[string][]byte) ([]byte, error) {
+	exportData, err := yaml.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+
+	if err := writeZipEntry(writer, r2ExportName, exportData); err != nil {
+		return nil, err
+	}
+
+	for name, contents := range files {
+		if err := writeZipEntry(writer, name, contents); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Imports an r2modman profile export (.r2z) as a new modm8 profile and installs the mods it references.
+//
+// If profileName is empty, the name of the profile in the export is used.
+func ImportR2Profile(ctx context.Context, loader loaders.ModLoaderType, gameTitle, r2zPath, profileName string) (*R2Export, error) {
+	data, err := fileutil.ReadFile(r2zPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ImportR2ProfileData(ctx, loader, gameTitle, data, profileName)
+}
+
+// Fetches the profile behind an r2modman share code from Thunderstore and imports it as a new modm8 profile.
+//
+// If profileName is empty, the name of the profile in the export is used.
+func ImportR2ShareCode(ctx context.Context, loader loaders.ModLoaderType, gameTitle, code, profileName string) (*R2Export, error) {
+	data, err := FetchR2ShareCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	return ImportR2ProfileData(ctx, loader, gameTitle, data, profileName)
+}
+
+func ImportR2ProfileData(ctx context.Context, loader loaders.ModLoaderType, gameTitle string, data []byte, profileName string) (*R2Export, error) {
+	export, files, err := ReadR2Archive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(profileName) == "" {
+		profileName = export.ProfileName
+	}
+
+	return export, UnpackProfile(ctx, loader, gameTitle, profileName, export.ToManifest(), files)
+}
+
+// Exports the given profile as an r2modman profile (.r2z) at outPath, so it can be imported by r2modman users.
+func ExportR2Profile(loader loaders.ModLoaderType, gameTitle, profileName, outPath string) error {
+	data, err := BuildR2ProfileData(loader, gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.MkDirAll(filepath.Dir(outPath)); err != nil {
+		return err
+	}
+
+	return fileutil.WriteFile(outPath, data)
+}
+
+// Uploads the given profile to Thunderstore's legacy profile endpoint and returns a share code that r2modman users can import.
+func ExportR2ShareCode(loader loaders.ModLoaderType, gameTitle, profileName string) (string, error) {
+	data, err := BuildR2ProfileData(loader, gameTitle, profileName)
+	if err != nil {
+		return "", err
+	}
+
+	return UploadR2ShareCode(data)
+}
+
+func BuildR2ProfileData(loader loaders.ModLoaderType, gameTitle, profileName string) ([]byte, error) {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := NewR2Export(profileName, *manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ReadProfileConfigFiles(loader, gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return WriteR2Archive(export, files)
+}
+
+// Downloads the .r2z data of a profile shared via r2modman from Thunderstore's legacy profile endpoint.
+func FetchR2ShareCode(code string) ([]byte, error) {
+	url := fmt.Sprintf(R2_PROFILE_GET_URL, strings.TrimSpace(code))
+
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch: %s\n%v", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch: %s\nstatus: %d", url, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, found := strings.CutPrefix(strings.TrimSpace(string(body)), r2ProfileDataPrefix)
+	if !found {
+		return nil, errors.New("invalid profile data. share code may be invalid or expired")
+	}
+
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+}
+
+// Uploads .r2z data to Thunderstore's legacy profile endpoint and returns the resulting share code.
+func UploadR2ShareCode(data []byte) (string, error) {
+	body := r2ProfileDataPrefix + "\n" + base64.StdEncoding.EncodeToString(data)
+
+	res, err := http.Post(R2_PROFILE_CREATE_URL, "application/octet-stream", strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload profile: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("failed to upload profile\nstatus: %d", res.StatusCode)
+	}
+
+	var result struct {
+		Key string `json:"key"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse share code response: %v", err)
+	}
+
+	return result.Key, nil
+}
@@ -0,0 +1,389 @@
+package profile
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"modm8/backend/app/appcore"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/loaders"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type SnapshotReason string
+
+const (
+	SNAPSHOT_REASON_MANUAL  SnapshotReason = "manual"
+	SNAPSHOT_REASON_INSTALL SnapshotReason = "install"
+	SNAPSHOT_REASON_UPDATE  SnapshotReason = "update"
+	SNAPSHOT_REASON_REMOVE  SnapshotReason = "remove"
+	SNAPSHOT_REASON_RESTORE SnapshotReason = "restore"
+)
+
+// Snapshots are stored as regular profile archives, just with a different extension so they can't be mixed up.
+const SNAPSHOT_EXT = ".m8s"
+
+// Suffixes given to paths while a snapshot is being restored. See [RestoreSnapshot].
+const (
+	restoreStagedSuffix = ".m8restore"
+	restoreOldSuffix    = ".m8old"
+)
+
+type ProfileSnapshot struct {
+	ID          string         `json:"id"`
+	ProfileName string         `json:"profile_name"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Reason      SnapshotReason `json:"reason"`
+	ModCount    int            `json:"mod_count"`
+}
+
+// Returns the path to the dir holding the snapshots of every profile for the given game.
+//
+// This lives next to the profiles dir rather than inside it, otherwise snapshots would be picked up as profiles.
+func GameSnapshotsPath(gameTitle string) string {
+	return filepath.Join(paths.GameDir(gameTitle), "Snapshots")
+}
+
+func PathToProfileSnapshots(gameTitle, profileName string) string {
+	return filepath.Join(GameSnapshotsPath(gameTitle), profileName)
+}
+
+func PathToSnapshot(gameTitle, profileName, id string) string {
+	return filepath.Join(PathToProfileSnapshots(gameTitle, profileName), id+SNAPSHOT_EXT)
+}
+
+// Captures the manifest, lockfile and loader config dirs of a profile so that it can be rolled back later.
+//
+// Once the snapshot is saved, the oldest snapshots are deleted so that no more than `retention` remain.
+// A retention of 0 keeps every snapshot.
+func CreateSnapshot(gameTitle, profileName string, reason SnapshotReason, retention uint16) (*ProfileSnapshot, error) {
+	manifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ReadAllProfileConfigFiles(gameTitle, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockData, err := fileutil.ReadFile(PathToLockfile(gameTitle, profileName)); err == nil {
+		files[lockfileName] = lockData
+	}
+
+	createdAt := time.Now().UTC()
+	id, err := reserveSnapshotID(gameTitle, profileName, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %v", err)
+	}
+
+	err = WriteProfileArchive(PathToSnapshot(gameTitle, profileName, id), ProfileArchive{
+		Meta: ProfileArchiveMeta{
+			FormatVersion: PROFILE_ARCHIVE_FORMAT_VERSION,
+			ProfileName:   profileName,
+			GameTitle:     gameTitle,
+			ExportedAt:    createdAt,
+			Comment:       string(reason),
+		},
+		Manifest: *manifest,
+		Files:    files,
+	})
+
+	if err != nil {
+		DeleteSnapshot(gameTitle, profileName, id)
+		return nil, fmt.Errorf("failed to save snapshot: %v", err)
+	}
+
+	if err := PruneSnapshots(gameTitle, profileName, retention); err != nil {
+		return nil, err
+	}
+
+	return &ProfileSnapshot{
+		ID:          id,
+		ProfileName: profileName,
+		CreatedAt:   createdAt,
+		Reason:      reason,
+		ModCount:    countMods(*manifest),
+	}, nil
+}
+
+// Claims an ID based on when the snapshot was taken by exclusively creating its (empty) file.
+// Snapshots taken within the same millisecond get a numbered suffix rather than overwriting each other.
+func reserveSnapshotID(gameTitle, profileName string, createdAt time.Time) (string, error) {
+	if err := fileutil.MkDirAll(PathToProfileSnapshots(gameTitle, profileName)); err != nil {
+		return "", err
+	}
+
+	base := createdAt.Format("20060102-150405.000")
+	for n := 1; ; n++ {
+		id := base
+		if n > 1 {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		file, err := os.OpenFile(PathToSnapshot(gameTitle, profileName, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			return id, file.Close()
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
+
+// Snapshots the profile before it is modified, keeping as many snapshots as the settings say to.
+// Profiles without a manifest yet have nothing to roll back to, so they are skipped.
+func AutoSnapshot(settings *appcore.AppSettings, gameTitle, profileName string, reason SnapshotReason) error {
+	if exists, _ := ProfileExists(gameTitle, profileName); !exists {
+		return nil
+	}
+
+	if _, err := CreateSnapshot(gameTitle, profileName, reason, snapshotRetention(settings)); err != nil {
+		return fmt.Errorf("failed to snapshot profile before %s: %v", reason, err)
+	}
+
+	return nil
+}
+
+func snapshotRetention(settings *appcore.AppSettings) uint16 {
+	if settings == nil {
+		return 0
+	}
+
+	return settings.Profiles.SnapshotRetention
+}
+
+// Returns every snapshot of the given profile, newest first.
+func GetSnapshots(gameTitle, profileName string) ([]ProfileSnapshot, error) {
+	snapshots := []ProfileSnapshot{}
+
+	entries, err := os.ReadDir(PathToProfileSnapshots(gameTitle, profileName))
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		id, found := strings.CutSuffix(entry.Name(), SNAPSHOT_EXT)
+		if !found || entry.IsDir() {
+			continue
+		}
+
+		archive, err := ReadProfileArchiveSummary(PathToSnapshot(gameTitle, profileName, id))
+		if err != nil {
+			continue // Ignore anything we can't read rather than failing the whole list.
+		}
+
+		snapshots = append(snapshots, ProfileSnapshot{
+			ID:          id,
+			ProfileName: profileName,
+			CreatedAt:   archive.Meta.ExportedAt,
+			Reason:      SnapshotReason(archive.Meta.Comment),
+			ModCount:    countMods(archive.Manifest),
+		})
+	}
+
+	slices.SortFunc(snapshots, func(a, b ProfileSnapshot) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+
+		// Only taken in the same instant when they have a numbered suffix, where a longer ID is always the newer one.
+		if c := cmp.Compare(len(b.ID), len(a.ID)); c != 0 {
+			return c
+		}
+
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return snapshots, nil
+}
+
+func DeleteSnapshot(gameTitle, profileName, id string) error {
+	return os.Remove(PathToSnapshot(gameTitle, profileName, id))
+}
+
+// Deletes the oldest snapshots of the given profile until no more than `retention` remain. A retention of 0 does nothing.
+func PruneSnapshots(gameTitle, profileName string, retention uint16) error {
+	if retention == 0 {
+		return nil
+	}
+
+	snapshots, err := GetSnapshots(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	for i := int(retention); i < len(snapshots); i++ {
+		if err := DeleteSnapshot(gameTitle, profileName, snapshots[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A path that is swapped out for its staged replacement when restoring a snapshot.
+type restoreSwap struct {
+	final  string
+	staged string
+}
+
+// Rolls the given profile back to a snapshot, replacing its manifest, lockfile and loader config dirs.
+//
+// Everything is written next to its final location first and then swapped into place by renaming,
+// so a failure part way through leaves the profile as it was rather than half restored.
+// Once restored, mods that are no longer part of the profile are unlinked and any missing mods are installed and linked.
+func RestoreSnapshot(ctx context.Context, loader loaders.ModLoaderType, gameTitle, profileName, id string) error {
+	archive, err := ReadProfileArchive(PathToSnapshot(gameTitle, profileName, id))
+	if err != nil {
+		return err
+	}
+
+	prevManifest, err := GetManifest(gameTitle, profileName)
+	if err != nil {
+		return err
+	}
+
+	profileDir := PathToProfile(gameTitle, profileName)
+
+	// Every config dir that might need replacing, so configs created after the snapshot are removed too.
+	var configDirs []string
+	for ldr := range loaders.MOD_LOADERS {
+		dir, _ := loaders.GetConfigDir(ldr, profileDir)
+		if !slices.Contains(configDirs, dir) {
+			configDirs = append(configDirs, dir)
+		}
+	}
+
+	swaps := []restoreSwap{
+		{final: PathToManifest(gameTitle, profileName)},
+		{final: PathToLockfile(gameTitle, profileName)},
+	}
+
+	for _, dir := range configDirs {
+		swaps = append(swaps, restoreSwap{final: dir})
+	}
+
+	for i := range swaps {
+		swaps[i].staged = swaps[i].final + restoreStagedSuffix
+		os.RemoveAll(swaps[i].staged)
+	}
+
+	defer func() {
+		for _, swap := range swaps {
+			os.RemoveAll(swap.staged)
+		}
+	}()
+
+	//#region Stage
+	manifestData, err := json.MarshalIndent(archive.Manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := fileutil.WriteFile(swaps[0].staged, manifestData); err != nil {
+		return err
+	}
+
+	for name, contents := range archive.Files {
+		dest, err := safeJoin(profileDir, name)
+		if err != nil {
+			return err
+		}
+
+		staged := ""
+		for _, swap := range swaps[1:] {
+			if dest == swap.final || strings.HasPrefix(dest, swap.final+string(filepath.Separator)) {
+				staged = swap.staged + strings.TrimPrefix(dest, swap.final)
+				break
+			}
+		}
+
+		if staged == "" {
+			continue // Not something snapshots are responsible for.
+		}
+
+		if err := fileutil.MkDirAll(filepath.Dir(staged)); err != nil {
+			return err
+		}
+
+		if err := fileutil.WriteFile(staged, contents); err != nil {
+			return err
+		}
+	}
+	//#endregion
+
+	//#region Swap
+	var done []restoreSwap
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			os.RemoveAll(done[i].final)
+			os.Rename(done[i].final+restoreOldSuffix, done[i].final)
+		}
+	}
+
+	for _, swap := range swaps {
+		old := swap.final + restoreOldSuffix
+		os.RemoveAll(old)
+
+		if exists, _ := fileutil.ExistsAtPath(swap.final); exists {
+			if err := os.Rename(swap.final, old); err != nil {
+				rollback()
+				return fmt.Errorf("failed to restore snapshot: %v", err)
+			}
+		}
+
+		done = append(done, swap)
+
+		if exists, _ := fileutil.ExistsAtPath(swap.staged); exists {
+			if err := os.Rename(swap.staged, swap.final); err != nil {
+				rollback()
+				return fmt.Errorf("failed to restore snapshot: %v", err)
+			}
+		}
+	}
+
+	for _, swap := range done {
+		os.RemoveAll(swap.final + restoreOldSuffix)
+	}
+	//#endregion
+
+	// Unlink anything that was linked before but shouldn't be now.
+	for _, plat := range cachedModPlatforms {
+		for _, verFullName := range prevManifest.Mods[plat] {
+			if !prevManifest.IsModEnabled(plat, verFullName) {
+				continue
+			}
+
+			stillListed := slices.ContainsFunc(archive.Manifest.Mods[plat], func(name string) bool {
+				return strings.EqualFold(name, verFullName)
+			})
+
+			if !stillListed || !archive.Manifest.IsModEnabled(plat, verFullName) {
+				if err := UnlinkMod(loader, gameTitle, profileName, verFullName); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+
+	return InstallProfileMods(ctx, loader, gameTitle, profileName)
+}
+
+func countMods(manifest ProfileManifest) int {
+	count := 0
+	for _, mods := range manifest.Mods {
+		count += len(mods)
+	}
+
+	return count
+}
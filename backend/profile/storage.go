@@ -0,0 +1,208 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"modm8/backend/app/appcore"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Moves the Profiles and Snapshots dirs of every game that doesn't have its own location to newDir,
+// then saves newDir as the new location in the settings.
+func MoveGamesDir(settings *appcore.AppSettings, newDir string) error {
+	oldDir := paths.GamesDir()
+
+	err := relocateAndSave(settings, oldDir, newDir, func() {
+		appcore.SetGamesDir(settings, storagePathSetting(newDir, paths.DefaultGamesDir()))
+	})
+	if err != nil {
+		return err
+	}
+
+	// Links to anything inside the moved dir would otherwise point to where it used to be.
+	return retargetAllLinks(oldDir, newDir)
+}
+
+// Moves the global mod cache to newDir, saves it as the new location in the settings,
+// then updates every link in every profile that pointed into the old location.
+func MoveModCacheDir(settings *appcore.AppSettings, newDir string) error {
+	oldDir := paths.ModCacheDir()
+
+	err := relocateAndSave(settings, oldDir, newDir, func() {
+		appcore.SetModCacheDir(settings, storagePathSetting(newDir, paths.DefaultModCacheDir()))
+	})
+	if err != nil {
+		return err
+	}
+
+	return retargetAllLinks(oldDir, newDir)
+}
+
+// Moves the Profiles and Snapshots dirs of the given game to newDir and saves it as the game's location in the settings.
+// An empty newDir moves the game back to the global games dir.
+func MoveGameDir(settings *appcore.AppSettings, gameTitle, newDir string) error {
+	oldDir := paths.GameDir(gameTitle)
+
+	defaultDir := filepath.Join(paths.GamesDir(), gameTitle)
+	if strings.TrimSpace(newDir) == "" {
+		newDir = defaultDir
+	}
+
+	err := relocateAndSave(settings, oldDir, newDir, func() {
+		storage := settings.GetGameStorage(gameTitle)
+		storage.GameDir = storagePathSetting(newDir, defaultDir)
+
+		appcore.SetGameStorage(settings, gameTitle, storage)
+	})
+	if err != nil {
+		return err
+	}
+
+	return retargetAllLinks(oldDir, newDir)
+}
+
+// Moves the mod cache of the given game to newDir, saves it as the game's mod cache in the settings,
+// then updates every link in the game's profiles that pointed into the old location.
+// An empty newDir moves the game's mods back into the global mod cache.
+func MoveGameModCache(settings *appcore.AppSettings, gameTitle, newDir string) error {
+	oldDir := paths.GameModCacheDir(gameTitle)
+
+	defaultDir := paths.DefaultGameModCacheDir(gameTitle)
+	if strings.TrimSpace(newDir) == "" {
+		newDir = defaultDir
+	}
+
+	err := relocateAndSave(settings, oldDir, newDir, func() {
+		storage := settings.GetGameStorage(gameTitle)
+		storage.ModCacheDir = storagePathSetting(newDir, defaultDir)
+
+		appcore.SetGameStorage(settings, gameTitle, storage)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fileutil.RetargetLinks(paths.GameDir(gameTitle), oldDir, newDir)
+	return err
+}
+
+// Moves oldDir to newDir, then saves the new location set by update in the settings.
+//
+// If the settings can't be saved, they are put back and the data is moved back to oldDir,
+// so the data never ends up somewhere the settings don't point to. Refuses to move anything while other operations are running.
+func relocateAndSave(settings *appcore.AppSettings, oldDir, newDir string, update func()) error {
+	if err := requireIdle(); err != nil {
+		return err
+	}
+
+	moved, err := relocateDir(oldDir, newDir)
+	if err != nil {
+		return err
+	}
+
+	prevStorage := settings.Storage
+	prevStorage.Games = maps.Clone(settings.Storage.Games)
+
+	update()
+	if err := settings.SaveAndApply(); err != nil {
+		settings.Storage = prevStorage
+		settings.Apply()
+
+		if moved {
+			if moveErr := fileutil.MoveDir(newDir, oldDir); moveErr != nil {
+				return fmt.Errorf("failed to save the new location, then failed to move everything back from %s:\n%w", newDir, errors.Join(err, moveErr))
+			}
+		}
+
+		return fmt.Errorf("failed to save the new location, so nothing was moved:\n%w", err)
+	}
+
+	return nil
+}
+
+// Moves oldDir to newDir after making sure it is safe to do so, reporting whether anything was moved.
+// Nothing happens if oldDir doesn't exist yet.
+func relocateDir(oldDir, newDir string) (bool, error) {
+	if strings.TrimSpace(newDir) == "" {
+		return false, errors.New("new location must be non-empty")
+	}
+	if !filepath.IsAbs(newDir) {
+		return false, fmt.Errorf("new location must be an absolute path: %s", newDir)
+	}
+
+	if filepath.Clean(oldDir) == filepath.Clean(newDir) {
+		return false, nil
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(oldDir); !exists {
+		return false, nil
+	}
+
+	return true, fileutil.MoveDir(oldDir, newDir)
+}
+
+// Updates the links of every profile of every known game from oldDir to newDir.
+func retargetAllLinks(oldDir, newDir string) error {
+	var errBuilder strings.Builder
+	for _, game := range knownGames() {
+		if _, err := fileutil.RetargetLinks(game.Dir, oldDir, newDir); err != nil {
+			errBuilder.WriteString(err.Error())
+		}
+	}
+
+	if errBuilder.Len() > 0 {
+		return fmt.Errorf("moved successfully, but some mods could not be relinked. repairing the affected profiles should fix them:\n%s", errBuilder.String())
+	}
+
+	return nil
+}
+
+type knownGame struct {
+	Title string
+	Dir   string
+}
+
+// Returns the title and dir of every game that has profiles keyed by lower case game title,
+// including games stored outside of the global games dir.
+func knownGames() map[string]knownGame {
+	games := make(map[string]knownGame)
+	if entries, err := os.ReadDir(paths.GamesDir()); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				games[strings.ToLower(entry.Name())] = knownGame{
+					Title: entry.Name(),
+					Dir:   filepath.Join(paths.GamesDir(), entry.Name()),
+				}
+			}
+		}
+	}
+
+	for key, game := range paths.GetStorageOverrides().Games {
+		if game.GameDir == "" {
+			continue
+		}
+
+		title := game.Title
+		if title == "" {
+			title = key
+		}
+
+		games[key] = knownGame{Title: title, Dir: game.GameDir}
+	}
+
+	return games
+}
+
+// Returns the value to save in the settings for a storage path, which is empty when it's the default so the default can change later.
+func storagePathSetting(path, defaultPath string) string {
+	if filepath.Clean(path) == filepath.Clean(defaultPath) {
+		return ""
+	}
+
+	return filepath.Clean(path)
+}
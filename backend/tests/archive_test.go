@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"context"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileArchiveRoundTrip(t *testing.T) {
+	manifest := profile.NewProfileManifest()
+	manifest.AddMod(platform.THUNDERSTORE, "Owen3H-IntroTweaks-1.5.0")
+
+	archivePath := filepath.Join(t.TempDir(), "test"+profile.PROFILE_ARCHIVE_EXT)
+	err := profile.WriteProfileArchive(archivePath, profile.ProfileArchive{
+		Meta: profile.ProfileArchiveMeta{
+			FormatVersion: profile.PROFILE_ARCHIVE_FORMAT_VERSION,
+			ProfileName:   "test",
+			GameTitle:     testGameTitle,
+			Loader:        loaders.BEPINEX,
+		},
+		Manifest: manifest,
+		Files: map[string][]byte{
+			"BepInEx/config/IntroTweaks.cfg": []byte("[General]\nEnabled = true\n"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to write profile archive:\n%v", err)
+	}
+
+	archive, err := profile.ReadProfileArchive(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read profile archive:\n%v", err)
+	}
+
+	if archive.Meta.GameTitle != testGameTitle || archive.Meta.Loader != loaders.BEPINEX {
+		t.Errorf("archive metadata does not match. got: %+v", archive.Meta)
+	}
+
+	if mods := archive.Manifest.Mods[platform.THUNDERSTORE]; len(mods) != 1 || mods[0] != "Owen3H-IntroTweaks-1.5.0" {
+		t.Errorf("archive manifest does not match. got: %v", mods)
+	}
+
+	if string(archive.Files["BepInEx/config/IntroTweaks.cfg"]) != "[General]\nEnabled = true\n" {
+		t.Errorf("config file missing or modified in archive")
+	}
+}
+
+func TestR2ArchiveRoundTrip(t *testing.T) {
+	manifest := profile.NewProfileManifest()
+	manifest.AddMod(platform.THUNDERSTORE, "BepInEx-BepInExPack-5.4.2100")
+	manifest.AddMod(platform.THUNDERSTORE, "Owen3H-CSync-3.0.1")
+	manifest.SetModEnabled(platform.THUNDERSTORE, "Owen3H-CSync-3.0.1", false)
+
+	export, err := profile.NewR2Export("test", manifest)
+	if err != nil {
+		t.Fatalf("failed to create r2modman export:\n%v", err)
+	}
+
+	data, err := profile.WriteR2Archive(export, map[string][]byte{
+		"BepInEx/config/CSync.cfg": []byte("[General]\n"),
+	})
+	if err != nil {
+		t.Fatalf("failed to write r2modman archive:\n%v", err)
+	}
+
+	readExport, files, err := profile.ReadR2Archive(data)
+	if err != nil {
+		t.Fatalf("failed to read r2modman archive:\n%v", err)
+	}
+
+	if readExport.ProfileName != "test" || len(files) != 1 {
+		t.Errorf("r2modman archive contents do not match. got: %+v, %d files", readExport, len(files))
+	}
+
+	imported := readExport.ToManifest()
+	if len(imported.Mods[platform.THUNDERSTORE]) != 2 {
+		t.Errorf("expected 2 mods after import. got: %v", imported.Mods[platform.THUNDERSTORE])
+	}
+
+	if imported.IsModEnabled(platform.THUNDERSTORE, "Owen3H-CSync-3.0.1") {
+		t.Errorf("expected Owen3H-CSync-3.0.1 to remain disabled after import")
+	}
+}
+
+func TestUnpackProfileRollback(t *testing.T) {
+	useTempStorage(t)
+
+	err := profile.UnpackProfile(context.Background(), loaders.BEPINEX, testGameTitle, "broken", profile.NewProfileManifest(), map[string][]byte{
+		"BepInEx/config/fine.cfg": []byte("fine"),
+		"../escaped.cfg":          []byte("escaped"),
+	})
+	if err == nil {
+		t.Fatal("expected an entry outside of the profile to be refused")
+	}
+
+	if _, err := os.Stat(profile.PathToProfile(testGameTitle, "broken")); !os.IsNotExist(err) {
+		t.Error("half created profile was left behind after a failed import")
+	}
+}
+
+func TestNewProfileMod(t *testing.T) {
+	mod, err := profile.NewProfileMod("Owen3H-IntroTweaks-1.5.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.ThunderstoreDownloadURL() != profile.THUNDERSTORE_DOWNLOAD_URL+"Owen3H/IntroTweaks/1.5.0/" {
+		t.Errorf("unexpected download url: %s", mod.ThunderstoreDownloadURL())
+	}
+
+	// Without a version there is nothing to download.
+	for _, name := range []string{"Owen3H-IntroTweaks", "Owen3H-IntroTweaks-", "Owen3H-Intro-Tweaks-1.5.0"} {
+		if _, err := profile.NewProfileMod(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"modm8/backend/game"
 	"modm8/backend/installing"
 	"modm8/backend/profile"
@@ -42,7 +43,7 @@ const testBepinexPackURL = "https://thunderstore.io/package/download/BepInEx/Bep
 func TestInstallBepinexPack(t *testing.T) {
 	profDir := profile.PathToProfile("Lethal Company", "test")
 
-	_, err := installing.InstallBepinexPack(testBepinexPackURL, profDir)
+	_, err := installing.InstallBepinexPack(context.Background(), testBepinexPackURL, profDir)
 	if err != nil {
 		t.Fatalf("failed to install BepInEx-Pack:\n%s", err)
 	}
@@ -0,0 +1,295 @@
+package backend
+
+import (
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
+	"modm8/backend/game"
+	"modm8/backend/loaders"
+	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevWatchSync(t *testing.T) {
+	root := useTempStorage(t)
+
+	if err := profile.SaveManifest(testGameTitle, "dev", profile.NewProfileManifest()); err != nil {
+		t.Fatal(err)
+	}
+
+	buildDir := filepath.Join(root, "MyPlugin")
+	if err := fileutil.MkDirAll(buildDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.WriteFile(filepath.Join(buildDir, "MyPlugin.dll"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(chan string, 8)
+	operations.SetHandler(func(event string, op operations.Operation) {
+		if event == operations.UPDATED_EVENT && strings.HasPrefix(op.Name, root) {
+			statuses <- op.Status
+		}
+	})
+	defer operations.SetHandler(nil)
+
+	w, err := game.StartDevWatch(game.DevWatchOptions{
+		Loader:      loaders.BEPINEX,
+		GameTitle:   testGameTitle,
+		ProfileName: "dev",
+		BuildDir:    buildDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer game.StopDevWatch(w.ID)
+
+	waitForSync := func() string {
+		select {
+		case status := <-statuses:
+			if strings.HasPrefix(status, "sync failed") {
+				t.Fatal(status)
+			}
+			return status
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for dev watch to sync")
+		}
+
+		return ""
+	}
+
+	// Synced straight away.
+	if status := waitForSync(); status != "synced 1 changed files" {
+		t.Fatalf("expected initial sync to copy 1 file, got %q", status)
+	}
+
+	if err := os.WriteFile(filepath.Join(buildDir, "MyPlugin.dll"), []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForSync()
+
+	contents, err := os.ReadFile(filepath.Join(w.Name, "MyPlugin.dll"))
+	if err != nil || string(contents) != "v2" {
+		t.Fatalf("rebuilt plugin was not synced into the profile, got %q: %v", contents, err)
+	}
+
+	if _, err := game.StartDevWatch(game.DevWatchOptions{
+		Loader:      loaders.BEPINEX,
+		GameTitle:   testGameTitle,
+		ProfileName: "dev",
+		BuildDir:    buildDir,
+	}); err == nil {
+		t.Error("expected a second watch into the same path to be refused")
+	}
+
+	// A dir the watch didn't create must never be synced over.
+	installed := filepath.Join(filepath.Dir(w.Name), "Someone-Mod-1.0.0")
+	if err := fileutil.MkDirAll(installed); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.WriteFile(filepath.Join(installed, "Mod.dll"), []byte("real")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := game.StartDevWatch(game.DevWatchOptions{
+		Loader:      loaders.BEPINEX,
+		GameTitle:   testGameTitle,
+		ProfileName: "dev",
+		BuildDir:    buildDir,
+		Name:        "Someone-Mod-1.0.0",
+	}); err == nil {
+		t.Error("expected a watch into an existing mod dir to be refused")
+	}
+
+	if _, err := game.StartDevWatch(game.DevWatchOptions{
+		Loader:      loaders.BEPINEX,
+		GameTitle:   testGameTitle,
+		ProfileName: "dev",
+		BuildDir:    buildDir,
+		Name:        "../../escaped",
+	}); err == nil {
+		t.Error("expected a watch named with a path to be refused")
+	}
+}
+
+func TestDevWatchLink(t *testing.T) {
+	root := useTempStorage(t)
+
+	if err := profile.SaveManifest(testGameTitle, "dev", profile.NewProfileManifest()); err != nil {
+		t.Fatal(err)
+	}
+
+	buildDir := filepath.Join(root, "MyPlugin")
+	if err := fileutil.MkDirAll(buildDir); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(chan string, 8)
+	finished := make(chan struct{}, 1)
+	operations.SetHandler(func(event string, op operations.Operation) {
+		// Watches left stopping by other tests report here too.
+		if !strings.HasPrefix(op.Name, root) {
+			return
+		}
+
+		switch event {
+		case operations.UPDATED_EVENT:
+			statuses <- op.Status
+		case operations.FINISHED_EVENT:
+			finished <- struct{}{}
+		}
+	})
+	defer operations.SetHandler(nil)
+
+	w, err := game.StartDevWatch(game.DevWatchOptions{
+		Loader:      loaders.BEPINEX,
+		GameTitle:   testGameTitle,
+		ProfileName: "dev",
+		BuildDir:    buildDir,
+		Mode:        game.DEV_WATCH_LINK,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer game.StopDevWatch(w.ID)
+
+	select {
+	case status := <-statuses:
+		if status != "linked build dir" {
+			t.Fatalf("expected build dir to be linked, got %q", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for dev watch to link")
+	}
+
+	if source, err := fileutil.ReadDirLink(w.Name); err != nil || filepath.Clean(source) != buildDir {
+		t.Fatalf("expected %s to link to the build dir, got %s: %v", w.Name, source, err)
+	}
+
+	// Builds show up through the link without syncing.
+	if err := fileutil.WriteFile(filepath.Join(buildDir, "MyPlugin.dll"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := os.ReadFile(filepath.Join(w.Name, "MyPlugin.dll")); err != nil || string(contents) != "v1" {
+		t.Fatalf("build output is not visible through the link, got %q: %v", contents, err)
+	}
+
+	if err := game.StopDevWatch(w.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for dev watch to stop")
+	}
+
+	if _, err := os.Lstat(w.Name); !os.IsNotExist(err) {
+		t.Error("link to the build dir was left behind after stopping the watch")
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(buildDir, "MyPlugin.dll")); !exists {
+		t.Error("removing the link deleted the build output")
+	}
+}
+
+func TestDevWatchRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stands in for the game with a shell script")
+	}
+
+	root := useTempStorage(t)
+
+	if err := profile.SaveManifest(testGameTitle, "dev", profile.NewProfileManifest()); err != nil {
+		t.Fatal(err)
+	}
+
+	buildDir := filepath.Join(root, "MyPlugin")
+	if err := fileutil.MkDirAll(buildDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records every start, then keeps running so the next sync has to stop it.
+	startsPath := filepath.Join(root, "starts.txt")
+	exePath := filepath.Join(root, "game.sh")
+	if err := os.WriteFile(exePath, []byte("#!/bin/sh\necho started >> \""+startsPath+"\"\nexec sleep 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := game.DevWatchOptions{
+		Loader:      loaders.BEPINEX,
+		GameTitle:   testGameTitle,
+		ProfileName: "dev",
+		BuildDir:    buildDir,
+		Restart:     true,
+		Target:      game.LaunchTarget{ExePath: exePath},
+	}
+
+	// Games started through a launcher can't be stopped again.
+	if _, err := game.StartDevWatch(opts); err == nil {
+		t.Fatal("expected restarting with the steam launcher to be refused")
+	}
+
+	cfg, err := profile.GetLaunchConfig(testGameTitle, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The profile has no loader installed to build the args from.
+	cfg.Launcher = profile.LAUNCHER_DIRECT
+	cfg.LoaderArgs = &[]string{}
+	if err := profile.SaveLaunchConfig(testGameTitle, "dev", *cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(chan string, 8)
+	operations.SetHandler(func(event string, op operations.Operation) {
+		if event == operations.UPDATED_EVENT && strings.HasPrefix(op.Name, root) {
+			statuses <- op.Status
+		}
+	})
+	defer operations.SetHandler(nil)
+
+	w, err := game.StartDevWatch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer game.StopDevWatch(w.ID)
+
+	waitForStarts := func(count int) {
+		select {
+		case status := <-statuses:
+			if strings.HasPrefix(status, "sync failed") {
+				t.Fatal(status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for dev watch to sync")
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			contents, _ := os.ReadFile(startsPath)
+			if strings.Count(string(contents), "started") == count {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the game to have been started %d times, got %q", count, contents)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	waitForStarts(1)
+
+	// Syncing by hand restarts the game, even without a rebuild.
+	if err := game.TriggerDevWatch(w.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForStarts(2)
+}
@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"modm8/backend/common/fileutil"
+	"modm8/backend/game"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+	"modm8/backend/profile"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffManifests(t *testing.T) {
+	from := profile.NewProfileManifest()
+	from.AddMod(platform.THUNDERSTORE, "Owen3H-CSync-3.0.1")
+	from.AddMod(platform.THUNDERSTORE, "Owen3H-IntroTweaks-1.5.0")
+	from.AddMod(platform.THUNDERSTORE, "Evaisa-LethalLib-0.16.1")
+	from.AddMod(platform.THUNDERSTORE, "sfDesat-Orion-2.1.4")
+
+	to := profile.NewProfileManifest()
+	to.AddMod(platform.THUNDERSTORE, "Owen3H-CSync-3.0.0")
+	to.AddMod(platform.THUNDERSTORE, "Owen3H-IntroTweaks-1.6.0")
+	to.AddMod(platform.THUNDERSTORE, "sfDesat-Orion-2.1.4")
+	to.AddMod(platform.THUNDERSTORE, "Megalophobia-MEGALOPHOBIA-1.0.0")
+	to.SetModEnabled(platform.THUNDERSTORE, "sfDesat-Orion-2.1.4", false)
+
+	diff := profile.DiffManifests(from, to)
+
+	if len(diff.Added) != 1 || diff.Added[0].FullName != "Megalophobia-MEGALOPHOBIA" {
+		t.Errorf("unexpected added mods: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].FullName != "Evaisa-LethalLib" {
+		t.Errorf("unexpected removed mods: %+v", diff.Removed)
+	}
+	if len(diff.Upgraded) != 1 || diff.Upgraded[0].FullName != "Owen3H-IntroTweaks" {
+		t.Errorf("unexpected upgraded mods: %+v", diff.Upgraded)
+	}
+	if len(diff.Downgraded) != 1 || diff.Downgraded[0].FullName != "Owen3H-CSync" {
+		t.Errorf("unexpected downgraded mods: %+v", diff.Downgraded)
+	}
+	if len(diff.EnabledChanged) != 1 || diff.EnabledChanged[0].Enabled {
+		t.Errorf("unexpected enabled state changes: %+v", diff.EnabledChanged)
+	}
+}
+
+func TestDiffBepinexConfigs(t *testing.T) {
+	from := map[string][]byte{
+		"BepInEx/config/IntroTweaks.cfg": []byte("[General]\n# Setting type: Boolean\nEnabled = true\nSkipIntro = false\n"),
+	}
+	to := map[string][]byte{
+		"BepInEx/config/IntroTweaks.cfg": []byte("[General]\n# Setting type: Boolean\nEnabled = false\nSkipIntro = false\nNewOption = 1\n"),
+	}
+
+	changes := game.DiffBepinexConfigs(from, to)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 config changes. got: %+v", changes)
+	}
+
+	if changes[0].Key != "General.Enabled" || *changes[0].From != "true" || *changes[0].To != "false" {
+		t.Errorf("unexpected change: %+v", changes[0])
+	}
+	if changes[1].Key != "General.NewOption" || changes[1].From != nil || *changes[1].To != "1" {
+		t.Errorf("unexpected change: %+v", changes[1])
+	}
+}
+
+func TestDiffSnapshot(t *testing.T) {
+	useTempStorage(t)
+
+	manifest := profile.NewProfileManifest()
+	manifest.AddMod(platform.THUNDERSTORE, "Owen3H-IntroTweaks-1.5.0")
+	if err := profile.SaveManifest(testGameTitle, "diffed", manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := profile.CreateSnapshot(testGameTitle, "diffed", profile.SNAPSHOT_REASON_MANUAL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest.AddMod(platform.THUNDERSTORE, "Owen3H-CSync-3.0.0")
+	if err := profile.SaveManifest(testGameTitle, "diffed", manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(profile.PathToProfile(testGameTitle, "diffed"), "BepInEx", "config", "CSync.cfg")
+	if err := fileutil.MkDirAll(filepath.Dir(configPath)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.WriteFile(configPath, []byte("[General]\nEnabled = true\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := game.DiffProfileWithSnapshot(loaders.BEPINEX, testGameTitle, "diffed", snapshot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Mods.Added) != 1 || diff.Mods.Added[0].FullName != "Owen3H-CSync" || len(diff.Mods.Removed) != 0 {
+		t.Errorf("expected only CSync to be added since the snapshot, got %+v", diff.Mods)
+	}
+	if len(diff.Configs) != 1 || diff.Configs[0].Key != "General.Enabled" || diff.Configs[0].From != nil {
+		t.Errorf("expected only the new CSync config to show up, got %+v", diff.Configs)
+	}
+}
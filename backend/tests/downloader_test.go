@@ -1,12 +1,22 @@
 package backend
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"modm8/backend/common/downloader"
 	"modm8/backend/common/fileutil"
 	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -100,3 +110,448 @@ func TestUnzipAndDelete(t *testing.T) {
 
 	t.Logf("\n\nSuccessfully unpacked and deleted:\n  %s", zipPath)
 }
+
+func TestDownloadFileResumable(t *testing.T) {
+	content := []byte(strings.Repeat("modm8", 20000))
+
+	// Drops the connection half way through the first request, then serves the rest (honouring Range) after that.
+	var requests, ranged atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && requests.Add(1) == 1 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:len(content)/2])
+			panic(http.ErrAbortHandler)
+		}
+
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+
+		http.ServeContent(w, r, "mod.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	policy := downloader.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	_, err := downloader.DownloadFileResumable(context.Background(), server.URL, dir, fileutil.NewFileInfo(dir, "mod", ZIP_EXT), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded, err := fileutil.ReadFile(filepath.Join(dir, "mod"+ZIP_EXT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("downloaded file does not match, got %d of %d bytes", len(downloaded), len(content))
+	}
+	if ranged.Load() == 0 {
+		t.Error("expected the retry to resume with a Range request")
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(dir, "mod"+ZIP_EXT+downloader.PARTIAL_EXT)); exists {
+		t.Error("expected partial file to be renamed once complete")
+	}
+}
+
+func TestCleanupPartialDownloads(t *testing.T) {
+	dir := t.TempDir()
+
+	stale := filepath.Join(dir, "stale.m8z"+downloader.PARTIAL_EXT)
+	recent := filepath.Join(dir, "recent.m8z"+downloader.PARTIAL_EXT)
+
+	for _, path := range []string{stale, recent} {
+		if err := fileutil.WriteFile(path, []byte("partial")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-2 * downloader.PARTIAL_MAX_AGE)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := downloader.CleanupPartialDownloads([]string{dir}, downloader.PARTIAL_MAX_AGE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 partial download to be deleted, got %d", count)
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(recent); !exists {
+		t.Error("expected recent partial download to be kept for resuming")
+	}
+
+	for retry := range 10 {
+		delay := downloader.DefaultRetryPolicy.Backoff(retry)
+		if delay > downloader.DefaultRetryPolicy.MaxDelay {
+			t.Errorf("backoff %v exceeds max delay", delay)
+		}
+	}
+
+	// Late enough retries would overflow the doubled delay if it wasn't capped first.
+	policy := downloader.RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+	for _, retry := range []int{31, 34, 40, 63, 100} {
+		if delay := policy.Backoff(retry); delay < policy.MaxDelay/2 || delay > policy.MaxDelay {
+			t.Errorf("expected retry %d to back off by the max delay, got %v", retry, delay)
+		}
+	}
+}
+
+func TestTrackProgress(t *testing.T) {
+	var events []downloader.ProgressEvent
+	var last downloader.AggregateProgress
+
+	downloader.SetProgressHandler(func(event downloader.ProgressEvent, aggregate downloader.AggregateProgress) {
+		events = append(events, event)
+		last = aggregate
+	})
+	defer downloader.SetProgressHandler(nil)
+
+	task, owned := downloader.TrackProgress("Owen3H-IntroTweaks-1.5.0")
+	if !owned {
+		t.Fatal("expected first call to start the task")
+	}
+
+	if inner, owned := downloader.TrackProgress("Owen3H-IntroTweaks-1.5.0"); owned || inner != task {
+		t.Fatal("expected second call to reuse the running task")
+	}
+
+	other, _ := downloader.TrackProgress("Owen3H-CSync-3.0.1")
+
+	task.SetPhase(downloader.PHASE_EXTRACT)
+	if last.Active != 2 {
+		t.Errorf("expected 2 active tasks, got %d", last.Active)
+	}
+
+	task.SetPhase(downloader.PHASE_LINK)
+	task.Finish(nil)
+	other.Finish(fmt.Errorf("oops"))
+
+	if last.Active != 0 || last.Completed != 1 || last.Failed != 1 {
+		t.Errorf("unexpected aggregate: %+v", last)
+	}
+
+	phases := []downloader.ProgressPhase{}
+	for _, event := range events {
+		if event.FullName == "Owen3H-IntroTweaks-1.5.0" {
+			phases = append(phases, event.Phase)
+		}
+	}
+
+	expected := []downloader.ProgressPhase{downloader.PHASE_EXTRACT, downloader.PHASE_LINK, downloader.PHASE_DONE}
+	if fmt.Sprint(phases) != fmt.Sprint(expected) {
+		t.Errorf("expected phases %v, got %v", expected, phases)
+	}
+
+	again, owned := downloader.TrackProgress("Owen3H-IntroTweaks-1.5.0")
+	if !owned {
+		t.Error("expected a finished task to be started again")
+	}
+
+	again.Finish(nil)
+}
+
+func TestDownloadQueue(t *testing.T) {
+	queue := downloader.NewDownloadQueue(1)
+	queue.Pause()
+
+	var mutex sync.Mutex
+	order := []string{}
+	runs := map[string]int{}
+
+	job := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			order = append(order, name)
+			runs[name]++
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	enqueue := func(key string, priority downloader.DownloadPriority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := queue.Do(context.Background(), key, priority, job(key)); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		// Give it time to be queued so the order is predictable.
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	enqueue("background", downloader.PRIORITY_BACKGROUND)
+	enqueue("normal", downloader.PRIORITY_NORMAL)
+	enqueue("user", downloader.PRIORITY_USER)
+	enqueue("normal", downloader.PRIORITY_NORMAL)
+
+	if status := queue.Status(); status.Queued != 3 || status.Running != 0 {
+		t.Fatalf("expected 3 queued jobs while paused, got %+v", status)
+	}
+
+	queue.Resume()
+	wg.Wait()
+
+	expected := []string{"user", "normal", "background"}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("expected jobs to run in order %v, got %v", expected, order)
+	}
+
+	if runs["normal"] != 1 {
+		t.Errorf("expected duplicate job to run once, ran %d times", runs["normal"])
+	}
+
+	// Cancelling the only waiter of a queued job drops it without running it.
+	queue.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := queue.Do(ctx, "cancelled", downloader.PRIORITY_NORMAL, job("cancelled")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected cancelled job to fail with context.DeadlineExceeded, got: %v", err)
+	}
+
+	if runs["cancelled"] != 0 || queue.Status().Queued != 0 {
+		t.Error("expected cancelled job to be dropped from the queue")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	// 1 MiB/s, starting with a full second's worth of tokens.
+	bucket := downloader.NewTokenBucket(1 << 20)
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := bucket.WaitN(ctx, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected initial burst to go through immediately, took %v", elapsed)
+	}
+
+	// The bucket is now empty, so another 100 KiB should take roughly 100ms.
+	start = time.Now()
+	if err := bucket.WaitN(ctx, 100<<10); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected to be limited, only took %v", elapsed)
+	}
+
+	// Waiting gives up as soon as ctx does.
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	if err := bucket.WaitN(timeout, 1<<20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected wait to fail with context.DeadlineExceeded, got: %v", err)
+	}
+
+	// Lifting the limit takes effect immediately, even with the bucket in debt.
+	bucket.SetRate(0)
+
+	start = time.Now()
+	if err := bucket.WaitN(ctx, 10<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected no limit after setting rate to 0, took %v", elapsed)
+	}
+
+	// Changing the rate keeps an empty bucket empty rather than handing out a fresh second's worth.
+	bucket.SetRate(1 << 20)
+	if err := bucket.WaitN(ctx, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket.SetRate(2 << 20)
+
+	start = time.Now()
+	if err := bucket.WaitN(ctx, 200<<10); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected changing the rate not to refill the bucket, only took %v", elapsed)
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	contents := []byte("not really a zip, but it doesn't need to be")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(contents)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	meta := installing.PackageInstallMeta{
+		FullName:    "Owen3H-IntroTweaks-1.5.0",
+		DownloadURL: server.URL,
+		FileSize:    int64(len(contents)) + 1,
+	}
+
+	_, err := installing.InstallToCache(context.Background(), meta, cacheDir)
+
+	var verifyErr *downloader.VerificationError
+	if !errors.As(err, &verifyErr) || verifyErr.Check != downloader.VERIFY_SIZE {
+		t.Fatalf("expected size verification to fail, got: %v", err)
+	}
+	if !errors.Is(err, downloader.ErrCorruptDownload) {
+		t.Error("expected verification error to match ErrCorruptDownload")
+	}
+
+	modPath := filepath.Join(cacheDir, meta.FullName)
+	for _, path := range []string{modPath, modPath + downloader.CUSTOM_ZIP_EXT} {
+		if exists, _ := fileutil.ExistsAtPath(path); exists {
+			t.Errorf("expected %s to be removed after failing verification", filepath.Base(path))
+		}
+	}
+
+	index, err := installing.GetCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index.Entries[meta.FullName]; ok {
+		t.Error("expected cache index entry to be removed after failing verification")
+	}
+
+	// The size matches, so only the hash gives it away.
+	meta.FileSize = int64(len(contents))
+	meta.SHA256 = strings.Repeat("0", 64)
+
+	_, err = installing.InstallToCache(context.Background(), meta, cacheDir)
+	if !errors.As(err, &verifyErr) || verifyErr.Check != downloader.VERIFY_SHA256 {
+		t.Fatalf("expected hash verification to fail, got: %v", err)
+	}
+}
+
+func TestInstallToCacheLayout(t *testing.T) {
+	zipOf := func(names ...string) []byte {
+		var buf bytes.Buffer
+		writer := zip.NewWriter(&buf)
+		for _, name := range names {
+			file, _ := writer.Create(name)
+			file.Write([]byte("{}"))
+		}
+		writer.Close()
+
+		return buf.Bytes()
+	}
+
+	archives := map[string][]byte{
+		"/nested":   zipOf("IntroTweaks/manifest.json", "IntroTweaks/IntroTweaks/mod.dll"),
+		"/unlisted": zipOf("mod.dll"),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archives[r.URL.Path])
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+
+	// Zipped inside its own dir, which is flattened so the manifest ends up at the root.
+	nested := installing.PackageInstallMeta{FullName: "Owen3H-IntroTweaks-1.5.0", DownloadURL: server.URL + "/nested"}
+	if _, err := installing.InstallToCache(context.Background(), nested, cacheDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"manifest.json", filepath.Join("IntroTweaks", "mod.dll")} {
+		if exists, _ := fileutil.ExistsAtPath(filepath.Join(cacheDir, nested.FullName, name)); !exists {
+			t.Errorf("expected %s at the root of the cached mod", name)
+		}
+	}
+
+	// No manifest at all, so it never makes it into the cache.
+	unlisted := installing.PackageInstallMeta{FullName: "Owen3H-CSync-3.0.0", DownloadURL: server.URL + "/unlisted"}
+	if _, err := installing.InstallToCache(context.Background(), unlisted, cacheDir); !errors.Is(err, installing.ErrInvalidPackage) {
+		t.Fatalf("expected a package without a manifest to be refused, got: %v", err)
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(cacheDir, unlisted.FullName)); exists {
+		t.Error("invalid package was moved into the cache")
+	}
+
+	index, err := installing.GetCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index.Entries[unlisted.FullName]; ok {
+		t.Error("expected cache index entry of the invalid package to be removed")
+	}
+}
+
+func TestStagedExtraction(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	file, _ := writer.Create("plugins/mod.dll")
+	file.Write([]byte("dll"))
+	writer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "Owen3H-IntroTweaks-1.5.0")
+
+	// Nothing becomes visible until the staged extraction is accepted.
+	_, err := downloader.DownloadAndUnzipOpts(server.URL, dest, downloader.DownloadOptions{
+		DeleteArchive: true,
+		BeforeCommit: func(stagingPath string) error {
+			if exists, _ := fileutil.ExistsAtPath(filepath.Join(stagingPath, "plugins", "mod.dll")); !exists {
+				t.Error("expected zip to be extracted into the staging dir")
+			}
+			if exists, _ := fileutil.ExistsAtPath(dest); exists {
+				t.Error("expected dest to not exist before being committed")
+			}
+
+			return errors.New("invalid package")
+		},
+	})
+
+	if err == nil {
+		t.Fatal("expected error from BeforeCommit to be returned")
+	}
+	if exists, _ := fileutil.ExistsAtPath(dest); exists {
+		t.Fatal("expected rejected extraction to never be moved into place")
+	}
+
+	staged, _ := os.ReadDir(filepath.Join(dir, fileutil.STAGING_DIR_NAME))
+	if len(staged) != 0 {
+		t.Errorf("expected staging dir to be emptied, found %d entries", len(staged))
+	}
+
+	_, err = downloader.DownloadAndUnzipOpts(server.URL, dest, downloader.DownloadOptions{DeleteArchive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(dest, "plugins", "mod.dll")); !exists {
+		t.Fatal("expected extraction to be moved into place")
+	}
+
+	// Simulate an extraction that was interrupted by the app closing.
+	if _, err := fileutil.NewStagingDir(dest); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := fileutil.CleanupStagingDirs([]string{dir, filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 staging dir to be cleaned up, got %d", count)
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(dest, "plugins", "mod.dll")); !exists {
+		t.Error("expected committed extraction to be left alone by cleanup")
+	}
+}
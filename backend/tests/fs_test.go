@@ -1,6 +1,12 @@
 package backend
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"modm8/backend/common/fileutil"
 	"modm8/backend/profile"
@@ -75,3 +81,399 @@ func TestLinkDirFails(t *testing.T) {
 		t.Fatalf("link dir did not fail. expected to fail with source directory error")
 	}
 }
+
+func TestHashDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := fileutil.MkDirAll(filepath.Join(dir, "plugins")); err != nil {
+		t.Fatalf("failed test setup:\n%v", err)
+	}
+
+	fileutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte("{}"))
+	fileutil.WriteFile(filepath.Join(dir, "plugins", "Mod.dll"), []byte("dll"))
+
+	first, err := fileutil.HashDir(dir)
+	if err != nil {
+		t.Fatalf("failed to hash dir:\n%v", err)
+	}
+
+	second, _ := fileutil.HashDir(dir)
+	if first != second {
+		t.Fatalf("hashing the same dir twice gave different results")
+	}
+
+	fileutil.WriteFile(filepath.Join(dir, "plugins", "Mod.dll"), []byte("modified"))
+	if modified, _ := fileutil.HashDir(dir); modified == first {
+		t.Fatalf("hash did not change after a file was modified")
+	}
+}
+
+func TestMoveDirAndRetargetLinks(t *testing.T) {
+	root := t.TempDir()
+
+	oldCache := filepath.Join(root, "OldCache")
+	newCache := filepath.Join(root, "NewCache")
+	profileDir := filepath.Join(root, "Profiles", "test")
+
+	if err := fileutil.MkDirAll(filepath.Join(oldCache, "Owen3H-IntroTweaks-1.5.0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.WriteFile(filepath.Join(oldCache, "Owen3H-IntroTweaks-1.5.0", "IntroTweaks.dll"), []byte("dll")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.MkDirAll(profileDir); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(profileDir, "Owen3H-IntroTweaks-1.5.0")
+	if err := fileutil.LinkDir(link, filepath.Join(oldCache, "Owen3H-IntroTweaks-1.5.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fileutil.MoveDir(oldCache, newCache); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(link); exists {
+		t.Fatal("expected link to be broken after moving its source")
+	}
+
+	count, err := fileutil.RetargetLinks(filepath.Join(root, "Profiles"), oldCache, newCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 link to be updated, got %d", count)
+	}
+
+	contents, err := fileutil.ReadFile(filepath.Join(link, "IntroTweaks.dll"))
+	if err != nil || string(contents) != "dll" {
+		t.Errorf("link does not point to the moved mod: %v", err)
+	}
+
+	if err := fileutil.MoveDir(newCache, filepath.Join(newCache, "Nested")); err == nil {
+		t.Error("expected moving a dir into itself to fail")
+	}
+}
+
+func TestDedupDirs(t *testing.T) {
+	root := t.TempDir()
+	storeDir := filepath.Join(root, ".store")
+
+	modA := filepath.Join(root, "Owen3H-CSync-3.0.0")
+	modB := filepath.Join(root, "Owen3H-CSync-3.0.1")
+
+	for _, dir := range []string{modA, modB} {
+		if err := fileutil.MkDirAll(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(filepath.Join(dir, "CSync.dll"), []byte("identical dll")); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(filepath.Join(dir, "CSync.cfg"), []byte("identical cfg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Identical, but either hidden or still downloading, so they might not be finished yet.
+	staged := filepath.Join(modB, ".staging", "CSync.dll")
+	partial := filepath.Join(modB, "CSync.dll.part")
+	if err := fileutil.MkDirAll(filepath.Dir(staged)); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{staged, partial} {
+		if err := fileutil.WriteFile(path, []byte("identical dll")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := fileutil.DedupDirs(storeDir, []string{modA, modB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.FilesLinked != 1 || report.BytesSaved != 13 || report.TotalBytesSaved != 13 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	infoA, _ := os.Stat(filepath.Join(modA, "CSync.dll"))
+	infoB, _ := os.Stat(filepath.Join(modB, "CSync.dll"))
+	if !os.SameFile(infoA, infoB) {
+		t.Error("expected identical dlls to be linked")
+	}
+
+	for _, path := range []string{staged, partial} {
+		if info, _ := os.Stat(path); os.SameFile(infoA, info) {
+			t.Errorf("%s should never be linked", filepath.Base(path))
+		}
+	}
+
+	cfgA, _ := os.Stat(filepath.Join(modA, "CSync.cfg"))
+	cfgB, _ := os.Stat(filepath.Join(modB, "CSync.cfg"))
+	if os.SameFile(cfgA, cfgB) {
+		t.Error("config files should never be linked")
+	}
+
+	// Nothing is freed while the mods still use the stored copy.
+	if freed, err := fileutil.PruneStore(storeDir); err != nil || freed != 0 {
+		t.Errorf("pruned a stored file that is still in use: %d %v", freed, err)
+	}
+
+	os.RemoveAll(modA)
+	os.RemoveAll(modB)
+
+	if freed, err := fileutil.PruneStore(storeDir); err != nil || freed != 13 {
+		t.Errorf("expected the unused stored file to be pruned: %d %v", freed, err)
+	}
+}
+
+func TestLinkDirWithMode(t *testing.T) {
+	root := t.TempDir()
+
+	source := filepath.Join(root, "Cache", "Owen3H-IntroTweaks-1.5.0")
+	if err := fileutil.MkDirAll(filepath.Join(source, "config")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.WriteFile(filepath.Join(source, "config", "IntroTweaks.dll"), []byte("dll")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []fileutil.LinkMode{fileutil.LINK_MODE_HARDLINK, fileutil.LINK_MODE_COPY} {
+		target := filepath.Join(root, "Profiles", string(mode), "Owen3H-IntroTweaks-1.5.0")
+		if err := fileutil.MkDirAll(filepath.Dir(target)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fileutil.LinkDirWithMode(target, source, mode); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		contents, err := fileutil.ReadFile(filepath.Join(target, "config", "IntroTweaks.dll"))
+		if err != nil || string(contents) != "dll" {
+			t.Errorf("%s: linked dir is missing its contents: %v", mode, err)
+		}
+
+		if got := fileutil.DirLinkMode(target); got != mode {
+			t.Errorf("expected mode %s, got %s", mode, got)
+		}
+
+		if linkSource, err := fileutil.ReadDirLink(target); err != nil || linkSource != source {
+			t.Errorf("%s: expected source %s, got %s (%v)", mode, source, linkSource, err)
+		}
+
+		if err := fileutil.UnlinkDir(target); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		if exists, _ := fileutil.ExistsAtPath(source); !exists {
+			t.Fatalf("%s: unlinking removed the source", mode)
+		}
+	}
+
+	// A real dir that wasn't linked by us must never be removed.
+	plain := filepath.Join(root, "Profiles", "Manual")
+	if err := fileutil.MkDirAll(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fileutil.UnlinkDir(plain); err == nil {
+		t.Error("expected unlinking a plain dir to fail")
+	}
+
+	if mode := fileutil.ProbeLinkMode(filepath.Join(root, "Profiles"), filepath.Join(root, "Cache")); mode == fileutil.LINK_MODE_AUTO || mode == "" {
+		t.Errorf("expected probing to settle on a mode, got %q", mode)
+	}
+}
+
+func TestUnsafeZipsRejected(t *testing.T) {
+	build := func(write func(w *zip.Writer)) []byte {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		write(w)
+		w.Close()
+
+		return buf.Bytes()
+	}
+
+	addFile := func(w *zip.Writer, name string, contents []byte) {
+		f, _ := w.Create(name)
+		f.Write(contents)
+	}
+
+	cases := map[string][]byte{
+		"../evil.dll":         build(func(w *zip.Writer) { addFile(w, "../evil.dll", []byte("x")) }),
+		"plugins\\..\\..\\x":  build(func(w *zip.Writer) { addFile(w, "plugins\\..\\..\\x", []byte("x")) }),
+		"/etc/evil":           build(func(w *zip.Writer) { addFile(w, "/etc/evil", []byte("x")) }),
+		"C:/Windows/evil.dll": build(func(w *zip.Writer) { addFile(w, "C:/Windows/evil.dll", []byte("x")) }),
+		"link": build(func(w *zip.Writer) {
+			header := &zip.FileHeader{Name: "link"}
+			header.SetMode(os.ModeSymlink | 0o777)
+			f, _ := w.CreateHeader(header)
+			f.Write([]byte("/etc"))
+		}),
+		// Zeros compress far beyond the allowed ratio.
+		"bomb.bin": build(func(w *zip.Writer) { addFile(w, "bomb.bin", make([]byte, 8<<20)) }),
+	}
+
+	for entry, data := range cases {
+		_, err := fileutil.GetFilesInZip(data)
+
+		var entryErr *fileutil.ArchiveEntryError
+		if !errors.As(err, &entryErr) || entryErr.Entry != entry {
+			t.Errorf("expected %s to be rejected, got: %v", entry, err)
+		}
+
+		// The same goes for extracting it to disk, which must not write anything.
+		dir := t.TempDir()
+		zipPath := filepath.Join(dir, "mod.zip")
+		dest := filepath.Join(dir, "mod")
+
+		os.WriteFile(zipPath, data, 0o644)
+		if err := fileutil.DoUnzip(zipPath, dest); !errors.Is(err, fileutil.ErrUnsafeArchive) {
+			t.Errorf("expected extracting %s to fail with ErrUnsafeArchive, got: %v", entry, err)
+		}
+
+		if entries, _ := os.ReadDir(dest); len(entries) > 0 {
+			t.Errorf("expected nothing to be extracted from the archive containing %s", entry)
+		}
+	}
+
+	// Nested paths and small repetitive files are fine.
+	data := build(func(w *zip.Writer) {
+		addFile(w, "BepInEx/plugins/mod.dll", []byte("dll"))
+		addFile(w, "config.txt", bytes.Repeat([]byte("a"), 1000))
+	})
+
+	if _, err := fileutil.GetFilesInZip(data); err != nil {
+		t.Errorf("expected safe zip to be accepted, got: %v", err)
+	}
+}
+
+func TestExtractArchiveTarGz(t *testing.T) {
+	build := func(files map[string]string, link string) string {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+
+		for name, contents := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(contents))
+		}
+
+		if link != "" {
+			tw.WriteHeader(&tar.Header{Name: link, Linkname: "/etc", Typeflag: tar.TypeSymlink})
+		}
+
+		tw.Close()
+		gz.Close()
+
+		// Named like a zip on purpose, the format should come from the contents.
+		path := filepath.Join(t.TempDir(), "mod.zip")
+		os.WriteFile(path, buf.Bytes(), 0o644)
+
+		return path
+	}
+
+	path := build(map[string]string{"BepInEx/plugins/mod.dll": "dll", "README.md": "readme"}, "")
+	if format, err := fileutil.DetectArchiveFormat(path); err != nil || format != fileutil.ARCHIVE_FORMAT_TAR_GZ {
+		t.Fatalf("expected tar.gz to be detected, got %s (%v)", format, err)
+	}
+
+	var lastWritten, lastTotal int64
+	dest := t.TempDir()
+
+	err := fileutil.ExtractArchiveContext(context.Background(), path, dest, func(written, total int64) {
+		lastWritten, lastTotal = written, total
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(filepath.Join(dest, "BepInEx", "plugins", "mod.dll"))
+	if err != nil || string(contents) != "dll" {
+		t.Errorf("expected mod.dll to be extracted, got %q (%v)", contents, err)
+	}
+	if lastWritten != 9 || lastTotal != 9 {
+		t.Errorf("expected final progress to be 9/9 bytes, got %d/%d", lastWritten, lastTotal)
+	}
+
+	// The same safeguards apply as for zips.
+	for entry, path := range map[string]string{
+		"../evil.dll": build(map[string]string{"../evil.dll": "x"}, ""),
+		"link":        build(nil, "link"),
+	} {
+		dest := t.TempDir()
+
+		var entryErr *fileutil.ArchiveEntryError
+		if err := fileutil.ExtractArchive(path, dest); !errors.As(err, &entryErr) || entryErr.Entry != entry {
+			t.Errorf("expected %s to be rejected, got: %v", entry, err)
+		}
+
+		if entries, _ := os.ReadDir(dest); len(entries) > 0 {
+			t.Errorf("expected nothing to be extracted from the tarball containing %s", entry)
+		}
+	}
+
+	// Only the signature matters for detection.
+	for format, signature := range map[fileutil.ArchiveFormat]string{
+		fileutil.ARCHIVE_FORMAT_7Z:  "7z\xBC\xAF\x27\x1C\x00\x04",
+		fileutil.ARCHIVE_FORMAT_RAR: "Rar!\x1A\x07\x01\x00",
+	} {
+		path := filepath.Join(t.TempDir(), "mod")
+		os.WriteFile(path, []byte(signature), 0o644)
+
+		if detected, err := fileutil.DetectArchiveFormat(path); err != nil || detected != format {
+			t.Errorf("expected %s to be detected, got %s (%v)", format, detected, err)
+		}
+	}
+
+	unknown := filepath.Join(t.TempDir(), "mod.txt")
+	os.WriteFile(unknown, []byte("hello"), 0o644)
+
+	if _, err := fileutil.DetectArchiveFormat(unknown); !errors.Is(err, fileutil.ErrUnsupportedArchive) {
+		t.Errorf("expected unknown format to fail with ErrUnsupportedArchive, got: %v", err)
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "build")
+	dest := filepath.Join(t.TempDir(), "dev-build")
+
+	if err := fileutil.MkDirAll(filepath.Join(src, "lang")); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{"mod.dll": "v1", "lang/en.json": "{}"} {
+		if err := fileutil.WriteFile(filepath.Join(src, name), []byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("mod.dll", filepath.Join(src, "current.dll")); err != nil {
+		t.Skipf("cannot create symlinks here: %v", err)
+	}
+
+	if changed, err := fileutil.SyncDir(src, dest); err != nil || changed != 3 {
+		t.Fatalf("expected 2 files and a link to be copied, got %d: %v", changed, err)
+	}
+	if changed, err := fileutil.SyncDir(src, dest); err != nil || changed != 0 {
+		t.Fatalf("expected nothing to change, got %d: %v", changed, err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(src, "lang")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.WriteFile(filepath.Join(src, "mod.dll"), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fileutil.SyncDir(src, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if contents, _ := os.ReadFile(filepath.Join(dest, "mod.dll")); string(contents) != "v2" {
+		t.Errorf("changed file was not copied, got %q", contents)
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(dest, "lang")); exists {
+		t.Error("dir removed from src is still in dest")
+	}
+}
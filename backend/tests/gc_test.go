@@ -0,0 +1,202 @@
+package backend
+
+import (
+	"context"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/paths"
+	"modm8/backend/installing"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectModCache(t *testing.T) {
+	useTempStorage(t)
+
+	cacheDir := paths.GameModCacheDir(testGameTitle)
+
+	for _, mod := range []string{
+		"Owen3H-IntroTweaks-1.4.0",
+		"Owen3H-IntroTweaks-1.5.0",
+		"Owen3H-CSync-3.0.0",
+		"Owen3H-CSync-3.0.1",
+	} {
+		if err := fileutil.MkDirAll(filepath.Join(cacheDir, mod)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(filepath.Join(cacheDir, mod, "mod.dll"), []byte("dll")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := profile.NewProfileManifest()
+	manifest.AddMod(platform.THUNDERSTORE, "Owen3H-IntroTweaks-1.5.0")
+	if err := profile.SaveManifest(testGameTitle, "test", manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := profile.CollectModCache(profile.CacheGCOptions{DryRun: true, KeepLatest: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CSync 3.0.1 is the latest version so it's kept, IntroTweaks 1.5.0 is referenced.
+	if report.Referenced != 1 || len(report.Kept) != 1 || len(report.Collected) != 2 {
+		t.Fatalf("unexpected dry run report: %+v", report)
+	}
+	if report.UnreferencedBytes != 9 || report.FreedBytes != 6 {
+		t.Errorf("unexpected sizes in dry run report: %+v", report)
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(cacheDir, "Owen3H-CSync-3.0.0")); !exists {
+		t.Fatal("dry run deleted a mod")
+	}
+
+	// Only the index knows how long ago a mod was cached, as the dirs were all just made.
+	err = installing.UpdateCacheIndex(cacheDir, func(index *installing.CacheIndex) {
+		index.Entries["Owen3H-CSync-3.0.0"] = installing.CacheIndexEntry{Complete: true, CachedAt: time.Now().AddDate(0, 0, -30)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = profile.CollectModCache(profile.CacheGCOptions{DryRun: true, OlderThanDays: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Collected) != 1 || report.Collected[0].VerFullName != "Owen3H-CSync-3.0.0" {
+		t.Fatalf("expected only the mod cached 30 days ago to be collected, got %+v", report.Collected)
+	}
+
+	report, err = profile.CollectModCache(profile.CacheGCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Collected) != 3 {
+		t.Fatalf("expected 3 mods to be collected, got %d", len(report.Collected))
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(cacheDir, "Owen3H-IntroTweaks-1.5.0")); !exists {
+		t.Error("referenced mod was collected")
+	}
+}
+
+func TestMigrateFlatModCache(t *testing.T) {
+	root := useTempStorage(t)
+	cacheRoot := filepath.Join(root, "ModCache")
+
+	// The last two are the mod caches of games without a profile, one of which happens to be named like a mod.
+	for _, mod := range []string{
+		"Owen3H-IntroTweaks-1.5.0",
+		"Owen3H-CSync-3.0.1",
+		filepath.Join("Content Warning", "Owen3H-CSync-3.0.1"),
+		filepath.Join("Some-Game-Title", "Owen3H-CSync-3.0.1"),
+	} {
+		if err := fileutil.MkDirAll(filepath.Join(cacheRoot, mod)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := profile.NewProfileManifest()
+	manifest.AddMod(platform.THUNDERSTORE, "Owen3H-IntroTweaks-1.5.0")
+	if err := profile.SaveManifest(testGameTitle, "test", manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Link it the way older versions did, straight into the flat cache.
+	link, _ := profile.PathToModLink(loaders.BEPINEX, testGameTitle, "test", "Owen3H-IntroTweaks-1.5.0")
+	if err := fileutil.MkDirAll(filepath.Dir(link)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.LinkDir(link, filepath.Join(cacheRoot, "Owen3H-IntroTweaks-1.5.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := profile.MigrateFlatModCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	namespaced := profile.PathToCachedMod(testGameTitle, "Owen3H-IntroTweaks-1.5.0")
+	if exists, _ := fileutil.ExistsAtPath(namespaced); !exists {
+		t.Fatal("referenced mod was not moved into the game's mod cache")
+	}
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(cacheRoot, "Owen3H-CSync-3.0.1")); exists {
+		t.Error("unreferenced mod was left in the flat mod cache")
+	}
+	for _, game := range []string{"Content Warning", "Some-Game-Title"} {
+		if exists, _ := fileutil.ExistsAtPath(filepath.Join(cacheRoot, game, "Owen3H-CSync-3.0.1")); !exists {
+			t.Errorf("mod cache of %s was mistaken for a flat mod", game)
+		}
+	}
+
+	if source, err := os.Readlink(link); err != nil || source != namespaced {
+		t.Errorf("link was not updated to the game's mod cache: %s %v", source, err)
+	}
+
+	report, err := profile.CollectModCache(profile.CacheGCOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unreferenced flat mod, along with the one in each game's cache that no profile uses either.
+	if report.Referenced != 1 || len(report.Collected) != 3 || report.Collected[0].VerFullName != "Owen3H-CSync-3.0.1" {
+		t.Errorf("unexpected report after migrating: %+v", report)
+	}
+}
+
+func TestVerifyModCache(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	for _, mod := range []string{"Owen3H-IntroTweaks-1.5.0", "Owen3H-CSync-3.0.1"} {
+		if err := fileutil.MkDirAll(filepath.Join(cacheDir, mod)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(filepath.Join(cacheDir, mod, "mod.dll"), []byte("dll")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues, err := installing.VerifyModCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 || issues[0].Category != installing.CACHE_ISSUE_UNINDEXED {
+		t.Fatalf("expected both mods to be unindexed, got %+v", issues)
+	}
+
+	// Unindexed mods are trusted and adopted into the index.
+	if remaining, err := installing.RepairModCache(context.Background(), cacheDir); err != nil || len(remaining) > 0 {
+		t.Fatalf("failed to adopt unindexed mods: %+v %v", remaining, err)
+	}
+
+	if err := fileutil.WriteFile(filepath.Join(cacheDir, "Owen3H-CSync-3.0.1", "mod.dll"), []byte("tampered")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = installing.UpdateCacheIndex(cacheDir, func(index *installing.CacheIndex) {
+		entry := index.Entries["Owen3H-IntroTweaks-1.5.0"]
+		entry.Complete = false
+		index.Entries["Owen3H-IntroTweaks-1.5.0"] = entry
+		index.Entries["Owen3H-Gone-1.0.0"] = installing.CacheIndexEntry{Complete: true}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err = installing.VerifyModCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]installing.CacheIssueCategory)
+	for _, issue := range issues {
+		found[issue.VerFullName] = issue.Category
+	}
+
+	if found["Owen3H-CSync-3.0.1"] != installing.CACHE_ISSUE_MODIFIED ||
+		found["Owen3H-IntroTweaks-1.5.0"] != installing.CACHE_ISSUE_INCOMPLETE ||
+		found["Owen3H-Gone-1.0.0"] != installing.CACHE_ISSUE_MISSING {
+		t.Errorf("unexpected issues: %+v", issues)
+	}
+}
@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"errors"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/game"
+	"modm8/backend/loaders"
+	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLaunchConfig(t *testing.T) {
+	root := useTempStorage(t)
+
+	if err := profile.SaveManifest(testGameTitle, "launch", profile.NewProfileManifest()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing saved yet, so the defaults are used.
+	cfg, err := profile.GetLaunchConfig(testGameTitle, "launch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Launcher != profile.LAUNCHER_STEAM {
+		t.Errorf("expected steam to be the default launcher, got %s", cfg.Launcher)
+	}
+
+	// Epic would have to drop the loader args, so they must be overridden with none.
+	cfg.Launcher = profile.LAUNCHER_EPIC
+	if err := profile.SaveLaunchConfig(testGameTitle, "launch", *cfg); !errors.Is(err, profile.ErrEpicLaunchArgs) {
+		t.Errorf("expected epic with the loader's own args to be refused, got: %v", err)
+	}
+
+	cfg.LoaderArgs = &[]string{}
+	if err := profile.SaveLaunchConfig(testGameTitle, "launch", *cfg); err != nil {
+		t.Errorf("expected epic without any args to be allowed, got: %v", err)
+	}
+
+	cfg.LoaderArgs = &[]string{"--doorstop-enable", "true"}
+	cfg.GameArgs = []string{"-screen-fullscreen", "0"}
+	cfg.Launcher = profile.LAUNCHER_DIRECT
+	if err := profile.SaveLaunchConfig(testGameTitle, "launch", *cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := profile.GetLaunchConfig(testGameTitle, "launch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := game.GetProfileLaunchArgs(loaders.BEPINEX, testGameTitle, "launch", *saved, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "--doorstop-enable true -screen-fullscreen 0" {
+		t.Errorf("expected loader args followed by game args, got %v", args)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// Stands in for the game, recording the args it was started with.
+	argsPath := filepath.Join(root, "args.txt")
+	exePath := filepath.Join(root, "game.sh")
+	if err := os.WriteFile(exePath, []byte("#!/bin/sh\necho \"$@\" > \""+argsPath+"\"\nsleep 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := game.LaunchProfile(loaders.BEPINEX, testGameTitle, "launch", game.LaunchTarget{ExePath: exePath}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if contents, _ := fileutil.ReadFile(argsPath); strings.TrimSpace(string(contents)) == strings.Join(args, " ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("game was not started with the profile's launch args")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	meta, err := profile.GetProfileMeta(testGameTitle, "launch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.LastPlayedAt == nil {
+		t.Error("launching the profile was not recorded as playing it")
+	}
+
+	// Playtime is only added once the game exits.
+	for meta.Playtime == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("time spent in game was not added to the profile's playtime")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if meta, err = profile.GetProfileMeta(testGameTitle, "launch"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
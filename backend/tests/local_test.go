@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/loaders"
+	"modm8/backend/platform"
+	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Accepts any package unless told otherwise, as the real checks are covered by thundergo.
+type stubValidator struct {
+	rejectIcon bool
+}
+
+func (v stubValidator) ValidateManifest(author string, data []byte) (bool, []error, error) {
+	return true, nil, nil
+}
+
+func (v stubValidator) ValidateReadme(data []byte) (bool, []error, error) {
+	return true, nil, nil
+}
+
+func (v stubValidator) ValidateIcon(data []byte) (bool, error) {
+	if v.rejectIcon {
+		return false, errors.New("icon must be 256x256")
+	}
+
+	return true, nil
+}
+
+func writeLocalPackage(t *testing.T, dir string) {
+	if err := fileutil.MkDirAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"manifest.json": `{"name": "IntroTweaks", "version_number": "1.6.0"}`,
+		"README.md":     "# IntroTweaks",
+		"icon.png":      "png",
+		"mod.dll":       "dll",
+	}
+
+	for name, contents := range files {
+		if err := fileutil.WriteFile(filepath.Join(dir, name), []byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInstallLocalMod(t *testing.T) {
+	root := useTempStorage(t)
+
+	const released = "Owen3H-IntroTweaks-1.5.0"
+	// Shares a name with the package being overridden, but isn't it.
+	const namesake = "Someone-IntroTweaks-1.0.0"
+
+	manifest := profile.NewProfileManifest()
+	for _, mod := range []string{released, namesake} {
+		if err := fileutil.MkDirAll(profile.PathToCachedMod(testGameTitle, mod)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(filepath.Join(profile.PathToCachedMod(testGameTitle, mod), "mod.dll"), []byte("dll")); err != nil {
+			t.Fatal(err)
+		}
+
+		manifest.AddMod(platform.THUNDERSTORE, mod)
+	}
+
+	if err := profile.SaveManifest(testGameTitle, "local", manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, mod := range []string{released, namesake} {
+		if err := profile.LinkMod(loaders.BEPINEX, testGameTitle, "local", mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot, err := profile.CreateSnapshot(testGameTitle, "local", profile.SNAPSHOT_REASON_MANUAL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := filepath.Join(root, "build")
+	writeLocalPackage(t, source)
+
+	ctx := context.Background()
+	_, err = profile.InstallLocalMod(ctx, stubValidator{rejectIcon: true}, loaders.BEPINEX, testGameTitle, "local", source, "Owen3H-IntroTweaks")
+	if err == nil {
+		t.Fatal("expected package with an invalid icon to be rejected")
+	}
+
+	verFullName, err := profile.InstallLocalMod(ctx, stubValidator{}, loaders.BEPINEX, testGameTitle, "local", source, "Owen3H-IntroTweaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verFullName != "local-IntroTweaks-1.6.0" {
+		t.Fatalf("unexpected full name: %s", verFullName)
+	}
+
+	// Importing the same version again replaces the previous build.
+	if _, err := profile.InstallLocalMod(ctx, stubValidator{}, loaders.BEPINEX, testGameTitle, "local", source, "Owen3H-IntroTweaks"); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(filepath.Join(profile.PathToCachedMod(testGameTitle, verFullName), "mod.dll")); !exists {
+		t.Fatal("local mod was not imported into the mod cache")
+	}
+	// Nothing of the previous import should be carried into the new one.
+	if entries, _ := os.ReadDir(profile.PathToCachedMod(testGameTitle, verFullName)); len(entries) != 4 {
+		t.Fatalf("expected only the 4 files of the package to be cached, got %d", len(entries))
+	}
+
+	updated, err := profile.GetManifest(testGameTitle, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Mods[platform.LOCAL]) != 1 || updated.IsModEnabled(platform.THUNDERSTORE, released) {
+		t.Fatalf("expected local mod to override %s: %+v", released, updated)
+	}
+	if !updated.IsModEnabled(platform.THUNDERSTORE, namesake) {
+		t.Errorf("%s was overridden, but is by a different author", namesake)
+	}
+
+	linkPath, _ := profile.PathToModLink(loaders.BEPINEX, testGameTitle, "local", released)
+	if _, err := os.Lstat(linkPath); !os.IsNotExist(err) {
+		t.Error("overridden mod is still linked")
+	}
+
+	// Links made by a dev watch point outside the mod cache, so they aren't orphans.
+	if err := fileutil.LinkDir(filepath.Join(filepath.Dir(linkPath), "dev-MyPlugin"), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := profile.CheckProfileHealth(loaders.BEPINEX, testGameTitle, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) > 0 {
+		t.Errorf("expected profile with a local mod and a dev watch to be healthy, got %+v", issues)
+	}
+
+	// Restoring to before the override brings back the mod it overrode, and only that.
+	if err := profile.RestoreSnapshot(ctx, loaders.BEPINEX, testGameTitle, "local", snapshot.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	localLink, _ := profile.PathToModLink(loaders.BEPINEX, testGameTitle, "local", verFullName)
+	if _, err := os.Lstat(localLink); !os.IsNotExist(err) {
+		t.Error("local mod is still linked after restoring a snapshot from before it was installed")
+	}
+	if _, err := os.Lstat(linkPath); err != nil {
+		t.Errorf("overridden mod was not relinked after restoring: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
+	"modm8/backend/installing"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelInstallToCache(t *testing.T) {
+	// Sends a little then stalls, so the download is still in progress when it gets cancelled.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000000")
+		w.Write(make([]byte, 1000))
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, op := operations.Start(operations.OP_INSTALL, "Owen3H-IntroTweaks-1.5.0")
+
+	if list := operations.List(); len(list) != 1 || list[0].ID != op.ID {
+		t.Fatalf("expected operation to be registered, got %+v", list)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := operations.Cancel(op.ID); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	cacheDir := t.TempDir()
+	_, err := installing.InstallToCache(ctx, installing.PackageInstallMeta{FullName: "Owen3H-IntroTweaks-1.5.0", DownloadURL: server.URL}, cacheDir)
+	op.Finish(&err)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected install to be cancelled, got: %v", err)
+	}
+	if !op.Cancelled {
+		t.Error("expected operation to be marked as cancelled")
+	}
+	if len(operations.List()) != 0 {
+		t.Error("expected operation to be unregistered once finished")
+	}
+
+	modPath := filepath.Join(cacheDir, "Owen3H-IntroTweaks-1.5.0")
+	for _, path := range []string{modPath, modPath + downloader.CUSTOM_ZIP_EXT + downloader.PARTIAL_EXT} {
+		if exists, _ := fileutil.ExistsAtPath(path); exists {
+			t.Errorf("expected %s to be rolled back", filepath.Base(path))
+		}
+	}
+
+	index, err := installing.GetCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index.Entries["Owen3H-IntroTweaks-1.5.0"]; ok {
+		t.Error("expected cache index entry to be rolled back")
+	}
+
+	if err := operations.Cancel(op.ID); !errors.Is(err, operations.ErrNotFound) {
+		t.Errorf("expected cancelling a finished operation to fail, got: %v", err)
+	}
+}
+
+func TestJoinedInstallToCache(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range []string{"manifest.json", "mod.dll"} {
+		file, _ := writer.Create(name)
+		file.Write([]byte("{}"))
+	}
+	writer.Close()
+
+	// Holds the download back until the second install has had time to join it.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	meta := installing.PackageInstallMeta{FullName: "Owen3H-IntroTweaks-1.5.0", DownloadURL: server.URL}
+
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := installing.InstallToCache(context.Background(), meta, cacheDir)
+		firstErr <- err
+	}()
+
+	// Joins the first install, then gives up on it, which must not roll back what the first one is doing.
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := installing.InstallToCache(ctx, meta, cacheDir); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected joined install to time out, got: %v", err)
+	}
+
+	// Joins again, this time expecting a different archive than the one being installed.
+	lockedMeta := meta
+	lockedMeta.SHA256 = strings.Repeat("0", 64)
+
+	lockedErr := make(chan error, 1)
+	go func() {
+		_, err := installing.InstallToCache(context.Background(), lockedMeta, cacheDir)
+		lockedErr <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-firstErr; err != nil {
+		t.Fatal(err)
+	}
+
+	var verr *downloader.VerificationError
+	if err := <-lockedErr; !errors.As(err, &verr) {
+		t.Fatalf("expected joined install with the wrong hash to be rejected, got: %v", err)
+	}
+
+	index, err := installing.GetCacheIndex(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := index.Entries[meta.FullName]; !entry.Complete {
+		t.Errorf("expected the first install to be left complete, got %+v", entry)
+	}
+}
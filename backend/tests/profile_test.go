@@ -1,16 +1,41 @@
 package backend
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"modm8/backend/app/appcore"
+	"modm8/backend/common/fileutil"
+	"modm8/backend/common/operations"
+	"modm8/backend/common/paths"
+	"modm8/backend/loaders"
 	"modm8/backend/platform"
 	"modm8/backend/profile"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/the-egg-corp/thundergo/util"
 )
 
 const testGameTitle = "Lethal Company"
 
+// Points the games dir and mod cache into a temp dir for the rest of the test, returning the temp dir.
+func useTempStorage(t *testing.T) string {
+	root := t.TempDir()
+
+	prevOverrides := paths.GetStorageOverrides()
+	paths.SetStorageOverrides(paths.StorageOverrides{
+		GamesDir:    filepath.Join(root, "Games"),
+		ModCacheDir: filepath.Join(root, "ModCache"),
+	})
+	t.Cleanup(func() { paths.SetStorageOverrides(prevOverrides) })
+
+	return root
+}
+
 func TestGetProfileNames(t *testing.T) {
 	names, err := profile.GetProfileNames(testGameTitle)
 	if err != nil {
@@ -46,3 +71,257 @@ func TestGetManifest(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSortProfileSummaries(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+
+	summaries := []profile.ProfileSummary{
+		{Name: "b", Meta: profile.ProfileMeta{Playtime: 30, LastPlayedAt: &earlier}},
+		{Name: "c", Meta: profile.ProfileMeta{Playtime: 10}},
+		{Name: "a", Meta: profile.ProfileMeta{Playtime: 30, LastPlayedAt: &now}},
+	}
+
+	profile.SortProfileSummaries(summaries, profile.PROFILE_SORT_PLAYTIME, true)
+	if summaries[0].Name != "a" || summaries[1].Name != "b" || summaries[2].Name != "c" {
+		t.Errorf("unexpected order when sorting by playtime: %s, %s, %s", summaries[0].Name, summaries[1].Name, summaries[2].Name)
+	}
+
+	// Never played profiles should come last regardless of direction.
+	profile.SortProfileSummaries(summaries, profile.PROFILE_SORT_LAST_PLAYED, false)
+	if summaries[0].Name != "b" || summaries[1].Name != "a" || summaries[2].Name != "c" {
+		t.Errorf("unexpected order when sorting by last played: %s, %s, %s", summaries[0].Name, summaries[1].Name, summaries[2].Name)
+	}
+
+	profile.SortProfileSummaries(summaries, profile.PROFILE_SORT_NAME, true)
+	if summaries[0].Name != "c" || summaries[2].Name != "a" {
+		t.Errorf("unexpected order when sorting by name: %s, %s, %s", summaries[0].Name, summaries[1].Name, summaries[2].Name)
+	}
+}
+
+func TestSnapshotIDsAreUnique(t *testing.T) {
+	useTempStorage(t)
+
+	if err := profile.SaveManifest(testGameTitle, "snaps", profile.NewProfileManifest()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quick enough that several land in the same millisecond.
+	ids := map[string]bool{}
+	for range 5 {
+		snapshot, err := profile.CreateSnapshot(testGameTitle, "snaps", profile.SNAPSHOT_REASON_MANUAL, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids[snapshot.ID] {
+			t.Fatalf("snapshot id %s was given out twice", snapshot.ID)
+		}
+		ids[snapshot.ID] = true
+	}
+
+	snapshots, err := profile.GetSnapshots(testGameTitle, "snaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 5 {
+		t.Fatalf("expected 5 snapshots, got %d", len(snapshots))
+	}
+}
+
+func TestMoveStorageWhileBusy(t *testing.T) {
+	_, op := operations.Start(operations.OP_INSTALL, "Owen3H-IntroTweaks-1.5.0")
+	defer op.Finish(nil)
+
+	newDir := filepath.Join(t.TempDir(), "Games")
+	if err := profile.MoveGamesDir(&appcore.AppSettings{}, newDir); !errors.Is(err, operations.ErrBusy) {
+		t.Fatalf("expected moving while an install is running to be refused, got: %v", err)
+	}
+
+	if exists, _ := fileutil.ExistsAtPath(newDir); exists {
+		t.Error("games dir was moved while an install was running")
+	}
+}
+
+func TestSnapshotLifecycle(t *testing.T) {
+	useTempStorage(t)
+
+	// Cached up front so restoring can link it without downloading anything.
+	cached := "Owen3H-IntroTweaks-1.5.0"
+	if err := fileutil.MkDirAll(profile.PathToCachedMod(testGameTitle, cached)); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(profile.PathToProfile(testGameTitle, "snapped"), "BepInEx", "config", "IntroTweaks.cfg")
+	save := func(config string, mods ...string) {
+		manifest := profile.NewProfileManifest()
+		for _, mod := range mods {
+			manifest.AddMod(platform.THUNDERSTORE, mod)
+		}
+
+		if err := profile.SaveManifest(testGameTitle, "snapped", manifest); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.MkDirAll(filepath.Dir(configPath)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(configPath, []byte(config)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save("Enabled = true", cached)
+	snapshot, err := profile.CreateSnapshot(testGameTitle, "snapped", profile.SNAPSHOT_REASON_MANUAL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save("Enabled = false", cached, "Owen3H-CSync-3.0.0")
+
+	pm := profile.NewProfileManager(&appcore.AppSettings{})
+	if err := pm.RestoreSnapshot(loaders.BEPINEX, testGameTitle, "snapped", snapshot.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := profile.GetManifest(testGameTitle, "snapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mods := manifest.Mods[platform.THUNDERSTORE]; len(mods) != 1 || mods[0] != cached {
+		t.Errorf("expected manifest to be restored, got %v", mods)
+	}
+	if config, _ := os.ReadFile(configPath); string(config) != "Enabled = true" {
+		t.Errorf("expected config to be restored, got %q", config)
+	}
+
+	// What was there before the restore is kept, so the restore can be undone.
+	snapshots, err := profile.GetSnapshots(testGameTitle, "snapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Reason != profile.SNAPSHOT_REASON_RESTORE || snapshots[0].ModCount != 2 {
+		t.Fatalf("expected a snapshot of the profile from before the restore, got %+v", snapshots)
+	}
+
+	if err := profile.PruneSnapshots(testGameTitle, "snapped", 1); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, _ := profile.GetSnapshots(testGameTitle, "snapped"); len(snapshots) != 1 || snapshots[0].Reason != profile.SNAPSHOT_REASON_RESTORE {
+		t.Errorf("expected only the newest snapshot to be kept, got %+v", snapshots)
+	}
+
+	// A new profile with the same name must not be able to restore the old one's snapshots.
+	if err := profile.DeleteProfile(testGameTitle, "snapped"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(profile.PathToProfileSnapshots(testGameTitle, "snapped")); !os.IsNotExist(err) {
+		t.Error("snapshots were left behind after deleting the profile")
+	}
+}
+
+func TestRepairProfile(t *testing.T) {
+	useTempStorage(t)
+
+	const intact = "Owen3H-CSync-3.0.1"
+	const relinked = "Owen3H-IntroTweaks-1.5.0"
+	const orphan = "Evaisa-LethalLib-0.16.1"
+	// Local mods can't be downloaded again, so repairing can't bring this one back.
+	const uncached = "local-MyPlugin-1.0.0"
+
+	for _, mod := range []string{intact, relinked, orphan, uncached} {
+		if err := fileutil.MkDirAll(profile.PathToCachedMod(testGameTitle, mod)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileutil.WriteFile(filepath.Join(profile.PathToCachedMod(testGameTitle, mod), "mod.dll"), []byte("dll")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := profile.NewProfileManifest()
+	manifest.AddMod(platform.THUNDERSTORE, intact)
+	manifest.AddMod(platform.THUNDERSTORE, relinked)
+	manifest.AddMod(platform.LOCAL, uncached)
+	if err := profile.SaveManifest(testGameTitle, "repaired", manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mod := range []string{intact, relinked, orphan, uncached} {
+		if err := profile.LinkMod(loaders.BEPINEX, testGameTitle, "repaired", mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Left pointing at an older version that has since been collected from the cache.
+	collected := profile.PathToCachedMod(testGameTitle, "Owen3H-IntroTweaks-1.4.0")
+	if err := fileutil.MkDirAll(collected); err != nil {
+		t.Fatal(err)
+	}
+
+	relinkedPath, _ := profile.PathToModLink(loaders.BEPINEX, testGameTitle, "repaired", relinked)
+	if err := fileutil.UnlinkDir(relinkedPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileutil.LinkDir(relinkedPath, collected); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(collected); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(profile.PathToCachedMod(testGameTitle, uncached)); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := profile.CheckProfileHealth(loaders.BEPINEX, testGameTitle, "repaired")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]profile.HealthIssueCategory{
+		relinked: profile.HEALTH_ISSUE_BROKEN_LINK,
+		orphan:   profile.HEALTH_ISSUE_ORPHAN_LINK,
+	}
+
+	found := make(map[string][]profile.HealthIssueCategory)
+	for _, issue := range issues {
+		found[issue.VerFullName] = append(found[issue.VerFullName], issue.Category)
+	}
+
+	for mod, category := range expected {
+		if len(found[mod]) != 1 || found[mod][0] != category {
+			t.Errorf("expected %s to have a %s issue, got %v", mod, category, found[mod])
+		}
+	}
+	if !slices.Contains(found[uncached], profile.HEALTH_ISSUE_NOT_CACHED) || !slices.Contains(found[uncached], profile.HEALTH_ISSUE_BROKEN_LINK) {
+		t.Errorf("expected %s to be reported as not cached and its link as broken, got %v", uncached, found[uncached])
+	}
+	if len(found[intact]) > 0 {
+		t.Errorf("expected %s to be healthy, got %v", intact, found[intact])
+	}
+
+	remaining, err := profile.RepairProfile(context.Background(), loaders.BEPINEX, testGameTitle, "repaired")
+	if err == nil {
+		t.Error("expected repairing to fail to bring back a local mod")
+	}
+
+	if !slices.ContainsFunc(remaining, func(issue profile.HealthIssue) bool { return issue.Category == profile.HEALTH_ISSUE_NOT_CACHED }) {
+		t.Errorf("expected %s to still be reported as not cached, got %+v", uncached, remaining)
+	}
+	for _, issue := range remaining {
+		if issue.VerFullName != uncached {
+			t.Errorf("expected only %s to remain broken, got %+v", uncached, issue)
+		}
+	}
+
+	if source, err := fileutil.ReadDirLink(relinkedPath); err != nil || filepath.Clean(source) != profile.PathToCachedMod(testGameTitle, relinked) {
+		t.Errorf("broken link was not pointed back at the cached mod, got %s: %v", source, err)
+	}
+
+	orphanPath, _ := profile.PathToModLink(loaders.BEPINEX, testGameTitle, "repaired", orphan)
+	if _, err := os.Lstat(orphanPath); !os.IsNotExist(err) {
+		t.Error("orphaned link was not removed")
+	}
+	uncachedPath, _ := profile.PathToModLink(loaders.BEPINEX, testGameTitle, "repaired", uncached)
+	if _, err := os.Lstat(uncachedPath); !os.IsNotExist(err) {
+		t.Error("link to the missing local mod was not removed")
+	}
+}
@@ -1,6 +1,8 @@
 package backend
 
 import (
+	"context"
+	"modm8/backend/common/paths"
 	"modm8/backend/installing"
 	"modm8/backend/loaders"
 	"modm8/backend/thunderstore"
@@ -78,7 +80,7 @@ func TestInstallWithDependencies(t *testing.T) {
 	}
 
 	startTime := time.Now()
-	thunderstore.InstallWithDependencies(meta, pkgs, &errs, &downloadCount)
+	thunderstore.InstallWithDependencies(context.Background(), meta, pkgs, paths.ModCacheDir(), &errs, &downloadCount)
 
 	t.Logf("\nDownloaded %v packages in %v\n", downloadCount, time.Since(startTime))
 }
@@ -1,12 +1,16 @@
 package thunderstore
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"modm8/backend/common/downloader"
+	"modm8/backend/common/operations"
 	"modm8/backend/common/paths"
 	"modm8/backend/common/util"
 	"modm8/backend/installing"
 	"modm8/backend/loaders"
+	"slices"
 	"strings"
 
 	"github.com/cavaliergopher/grab/v3"
@@ -47,9 +51,6 @@ var modExclusions = []string{
 	"GardenGals-Hatchery",
 }
 
-// The dir where the mod cache is located for the current game.
-var ModCacheDir = paths.ModCacheDir()
-
 // Same as a thundergo `Package` but the 'Versions' field is replaced with only a single 'LatestVersion' field
 // and the following fields are completely removed: [DonationLink, Pinned].
 type StrippedPackage struct {
@@ -224,7 +225,15 @@ func (api *ThunderstoreAPI) GetStrippedPackages(community string, skipCache bool
 // Installs the latest version of a package by its full name (Owner-PkgName) and all of its dependencies.
 //
 // The game identifier (aka community) must be correctly specified for the package to be found.
-func (api *ThunderstoreAPI) InstallByName(gameTitle, commIdent, fullName string) (*TSGOV1.PackageVersion, error) {
+//
+// The install is registered as an operation so it can be cancelled part way through. See [operations.Start].
+func (api *ThunderstoreAPI) InstallByName(gameTitle, commIdent, fullName string) (ver *TSGOV1.PackageVersion, err error) {
+	ctx, op := operations.Start(operations.OP_INSTALL, fullName)
+	defer op.Finish(&err)
+
+	// The user clicked install and is waiting on it, so it jumps ahead of anything in the background.
+	ctx = downloader.WithPriority(ctx, downloader.PRIORITY_USER)
+
 	ecosys, err := api.Schema.GetEcosystem()
 	if err != nil {
 		return nil, fmt.Errorf("could not get Thunderstore ecosystem")
@@ -258,18 +267,14 @@ func (api *ThunderstoreAPI) InstallByName(gameTitle, commIdent, fullName string)
 		FullName:     latestVer.FullName,
 		DownloadURL:  latestVer.DownloadURL,
 		Dependencies: latestVer.Dependencies,
+		FileSize:     int64(latestVer.FileSize),
 	}
 
-	InstallWithDependencies(meta, api.Cache[commIdent], &errs, &downloadCount)
+	InstallWithDependencies(ctx, meta, api.Cache[commIdent], paths.GameModCacheDir(gameTitle), &errs, &downloadCount)
 
+	// Joined rather than flattened into text, so a cancellation can still be told apart from a failure.
 	if len(errs) > 0 {
-		var errBuilder strings.Builder
-		for _, err := range errs {
-			errBuilder.WriteString(err.Error())
-			errBuilder.WriteString("\n")
-		}
-
-		return &latestVer, fmt.Errorf("errors occurred installing %s:\n%s", latestVer.FullName, errBuilder.String())
+		return &latestVer, fmt.Errorf("errors occurred installing %s:\n%w", latestVer.FullName, errors.Join(errs...))
 	}
 
 	return &latestVer, nil
@@ -280,8 +285,18 @@ func (api *ThunderstoreAPI) InstallByName(gameTitle, commIdent, fullName string)
 //
 // This function is recursive and calls [Install] for each dependency, any errors are accumulated into a slice and
 // the install count is incremented if no error occurred - both of which are available once this func has fully finished.
-func InstallWithDependencies(pkgInsMeta installing.PackageInstallMeta, pkgs TSGOV1.PackageList, errs *[]error, installCount *int) {
-	_, err := Install(pkgInsMeta, ModCacheDir)
+//
+// Once ctx is cancelled, no more packages are installed and the cancellation is added to the errors.
+func InstallWithDependencies(ctx context.Context, pkgInsMeta installing.PackageInstallMeta, pkgs TSGOV1.PackageList, cacheDir string, errs *[]error, installCount *int) {
+	if ctx.Err() != nil {
+		if !slices.Contains(*errs, ctx.Err()) {
+			*errs = append(*errs, ctx.Err())
+		}
+
+		return
+	}
+
+	_, err := Install(ctx, pkgInsMeta, cacheDir)
 	if err == nil {
 		*installCount += 1
 	}
@@ -303,20 +318,22 @@ func InstallWithDependencies(pkgInsMeta installing.PackageInstallMeta, pkgs TSGO
 			FullName:     ver.FullName,
 			DownloadURL:  ver.DownloadURL,
 			Dependencies: ver.Dependencies,
+			FileSize:     int64(ver.FileSize),
 		}
 
-		InstallWithDependencies(meta, pkgs, errs, installCount)
+		InstallWithDependencies(ctx, meta, pkgs, cacheDir, errs, installCount)
 	}
 }
 
 // Downloads the given package version as a zip and unpacks it to the specified dir path (expected to be absolute).
-func Install(pkgInsMeta installing.PackageInstallMeta, dirPath string) (*grab.Response, error) {
+// The zip is rejected if it doesn't match the size Thunderstore reported for it.
+func Install(ctx context.Context, pkgInsMeta installing.PackageInstallMeta, dirPath string) (*grab.Response, error) {
 	ins, err := installing.GetModInstaller(pkgInsMeta.Loader)
 	if err != nil {
 		return nil, err
 	}
 
-	return ins.Install(pkgInsMeta.DownloadURL, pkgInsMeta.FullName, dirPath)
+	return ins.Install(ctx, pkgInsMeta, dirPath)
 }
 
 // Downloads the specified package as a zip file and unpacks it under the specified directory (absolute path).
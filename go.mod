@@ -7,14 +7,29 @@ toolchain go1.24.2
 // replace github.com/wailsapp/wails/v2 v2.8.1 => C:\Users\Owen\go\pkg\mod
 
 require (
+	github.com/bodgit/sevenzip v1.6.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/go-cmd/cmd v1.4.3
 	github.com/mitchellh/mapstructure v1.5.0
+	github.com/nwaples/rardecode/v2 v2.1.0
 	github.com/spf13/viper v1.20.1
 	github.com/the-egg-corp/gonexus v1.0.0
 	github.com/the-egg-corp/thundergo v0.8.2
 	github.com/wailsapp/wails/v2 v2.10.2
 )
 
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/ulikunitz/xz v0.5.12 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+)
+
 require (
 	github.com/go-viper/mapstructure/v2 v2.3.0 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
@@ -24,7 +39,6 @@ require (
 
 require (
 	github.com/cavaliergopher/grab/v3 v3.0.1
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/hashicorp/go-version v1.7.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.4 // indirect
 	github.com/sagikazarmark/locafero v0.9.0 // indirect
@@ -34,7 +48,7 @@ require (
 	github.com/spf13/pflag v1.0.6 // indirect
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
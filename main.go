@@ -14,9 +14,12 @@ import (
 
 	"modm8/backend/app"
 	"modm8/backend/app/appcore"
+	"modm8/backend/common/fileutil"
 	"modm8/backend/common/paths"
+	"modm8/backend/game"
 	"modm8/backend/loaders"
 	"modm8/backend/platform"
+	"modm8/backend/profile"
 )
 
 //go:embed all:frontend/dist
@@ -30,6 +33,7 @@ type EnumBinding[T any] []struct {
 var ModPlatforms = EnumBinding[platform.ModPlatform]{
 	{platform.NEXUS, "NEXUS_MODS"},
 	{platform.THUNDERSTORE, "THUNDERSTORE"},
+	{platform.LOCAL, "LOCAL"},
 }
 
 var ModLoaders = EnumBinding[loaders.ModLoaderType]{
@@ -44,6 +48,33 @@ var UpdateBehaviours = EnumBinding[appcore.UpdateBehaviour]{
 	{appcore.UPDATE_BEHAVIOUR_AUTO, "AUTO"},
 }
 
+var LauncherTypes = EnumBinding[profile.LauncherType]{
+	{profile.LAUNCHER_STEAM, "STEAM"},
+	{profile.LAUNCHER_EPIC, "EPIC"},
+	{profile.LAUNCHER_DIRECT, "DIRECT"},
+}
+
+var ProfileSortFields = EnumBinding[profile.ProfileSortField]{
+	{profile.PROFILE_SORT_NAME, "NAME"},
+	{profile.PROFILE_SORT_CREATED, "CREATED"},
+	{profile.PROFILE_SORT_MODIFIED, "MODIFIED"},
+	{profile.PROFILE_SORT_LAST_PLAYED, "LAST_PLAYED"},
+	{profile.PROFILE_SORT_PLAYTIME, "PLAYTIME"},
+	{profile.PROFILE_SORT_MOD_COUNT, "MOD_COUNT"},
+}
+
+var LinkModes = EnumBinding[fileutil.LinkMode]{
+	{fileutil.LINK_MODE_AUTO, "AUTO"},
+	{fileutil.LINK_MODE_SYMLINK, "SYMLINK"},
+	{fileutil.LINK_MODE_HARDLINK, "HARDLINK"},
+	{fileutil.LINK_MODE_COPY, "COPY"},
+}
+
+var DevWatchModes = EnumBinding[game.DevWatchMode]{
+	{game.DEV_WATCH_SYNC, "SYNC"},
+	{game.DEV_WATCH_LINK, "LINK"},
+}
+
 var GameSelectionLayouts = EnumBinding[appcore.GameSelectionLayout]{
 	{appcore.GAME_SELECTION_LAYOUT_GRID, "GRID"},
 	{appcore.GAME_SELECTION_LAYOUT_LIST, "LIST"},
@@ -145,6 +176,8 @@ func main() {
 		services.SteamLauncher,
 		services.TSSchema,
 		services.TSAPI,
+		services.Operations,
+		services.DownloadQueue,
 		//services.TSDevTools.PackageValidator,
 	}
 
@@ -154,6 +187,10 @@ func main() {
 		GameSelectionLayouts,
 		ModLoaders,
 		ModPlatforms,
+		LauncherTypes,
+		ProfileSortFields,
+		LinkModes,
+		DevWatchModes,
 	}
 
 	// For now, avoid binding Nexus stuff in GH Actions since key file wont exist.